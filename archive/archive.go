@@ -14,18 +14,27 @@
 package archive
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 )
 
-// Run archive
-func Run(model config.ModelConfig) error {
-	logger := logger.Tag("Archive")
+var (
+	// tar: /etc/shadow: Warning: Cannot open: Permission denied
+	skippedFileRegexp = regexp.MustCompile(`(?m)^tar: (.+): Warning: (.+)$`)
+)
+
+// Run archive, the files tar failed to read are added to rr as skipped files
+func Run(ctx context.Context, model config.ModelConfig, rr *result.RunResult) error {
+	logger := logger.TagContext(ctx, "Archive")
 
 	if model.Archive == nil {
 		return nil
@@ -49,8 +58,26 @@ func Run(model config.ModelConfig) error {
 
 	opts := options(model.DumpPath, excludes, includes)
 
-	_, err := helper.Exec("tar", opts...)
-	return err
+	_, stderr, err := helper.ExecContextWithStderr(ctx, "tar", opts...)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range parseSkippedFiles(stderr) {
+		logger.Warnf("Skipped %s: %s", file.Path, file.Reason)
+		rr.AddSkippedFile(file.Path, file.Reason)
+	}
+
+	return nil
+}
+
+// parseSkippedFiles parse the warnings of `tar --ignore-failed-read`
+func parseSkippedFiles(stderr string) (files []result.SkippedFile) {
+	for _, match := range skippedFileRegexp.FindAllStringSubmatch(stderr, -1) {
+		files = append(files, result.SkippedFile{Path: match[1], Reason: strings.TrimSpace(match[2])})
+	}
+
+	return
 }
 
 func options(dumpPath string, excludes, includes []string) (opts []string) {
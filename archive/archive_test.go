@@ -14,11 +14,13 @@
 package archive
 
 import (
+	"context"
 	"strings"
 	"testing"
 
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,10 +29,23 @@ func TestRun(t *testing.T) {
 	model := config.ModelConfig{
 		Archive: nil,
 	}
-	err := Run(model)
+	err := Run(context.Background(), model, result.New("", "", ""))
 	assert.NoError(t, err)
 }
 
+func TestParseSkippedFiles(t *testing.T) {
+	stderr := `tar: Removing leading '/' from member names
+tar: /etc/shadow: Warning: Cannot open: Permission denied
+tar: /var/lib/foo bar: Warning: Cannot stat: No such file or directory
+`
+
+	assert.Equal(t, []result.SkippedFile{
+		{Path: "/etc/shadow", Reason: "Cannot open: Permission denied"},
+		{Path: "/var/lib/foo bar", Reason: "Cannot stat: No such file or directory"},
+	}, parseSkippedFiles(stderr))
+	assert.Empty(t, parseSkippedFiles(""))
+}
+
 func TestOptions(t *testing.T) {
 	includes := []string{
 		"/foo/bar/dar",
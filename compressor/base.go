@@ -16,6 +16,7 @@
 package compressor
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,6 +25,7 @@ import (
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/spf13/viper"
 )
 
@@ -38,7 +40,7 @@ type Base struct {
 
 // Compressor
 type Compressor interface {
-	perform() (archivePath string, err error)
+	perform(ctx context.Context) (archivePath string, err error)
 }
 
 func (c *Base) archiveFilePath(ext string) string {
@@ -55,8 +57,8 @@ func newBase(model config.ModelConfig) (base Base) {
 }
 
 // Run compressor, return archive path
-func Run(model config.ModelConfig) (string, error) {
-	logger := logger.Tag("Compressor")
+func Run(ctx context.Context, model config.ModelConfig, rr *result.RunResult) (string, error) {
+	logger := logger.TagContext(ctx, "Compressor")
 
 	base := newBase(model)
 
@@ -110,11 +112,12 @@ func Run(model config.ModelConfig) (string, error) {
 		return "", fmt.Errorf("chdir to dump path: %s: %w", model.DumpPath, err)
 	}
 
-	archivePath, err := c.perform()
+	archivePath, err := c.perform(ctx)
 	if err != nil {
 		return "", err
 	}
 	logger.Info("->", archivePath)
+	rr.SetArchive(archivePath)
 
 	return archivePath, nil
 }
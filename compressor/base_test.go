@@ -16,6 +16,7 @@
 package compressor
 
 import (
+	"context"
 	"path"
 	"strings"
 	"testing"
@@ -29,7 +30,7 @@ type Monkey struct {
 	Base
 }
 
-func (c Monkey) perform() (archivePath string, err error) {
+func (c Monkey) perform(ctx context.Context) (archivePath string, err error) {
 	result := "aaa"
 	return result, nil
 }
@@ -50,7 +51,7 @@ func TestBaseInterface(t *testing.T) {
 	assert.Equal(t, base.model, model)
 
 	c := Monkey{Base: base}
-	result, err := c.perform()
+	result, err := c.perform(context.Background())
 	assert.Equal(t, result, "aaa")
 	assert.Nil(t, err)
 }
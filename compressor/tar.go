@@ -16,6 +16,7 @@
 package compressor
 
 import (
+	"context"
 	"os/exec"
 
 	"github.com/hantbk/vtsbackup/helper"
@@ -25,7 +26,7 @@ type Tar struct {
 	Base
 }
 
-func (tar *Tar) perform() (archivePath string, err error) {
+func (tar *Tar) perform(ctx context.Context) (archivePath string, err error) {
 	filePath := tar.archiveFilePath(tar.ext)
 
 	opts := tar.options()
@@ -33,7 +34,7 @@ func (tar *Tar) perform() (archivePath string, err error) {
 	opts = append(opts, tar.name)
 	archivePath = filePath
 
-	_, err = helper.Exec("tar", opts...)
+	_, err = helper.ExecContext(ctx, "tar", opts...)
 
 	return
 }
@@ -41,6 +41,12 @@ var (
 	PidFilePath string = filepath.Join(VtsBackupDir, "vtsbackup.pid")
 	LogFilePath string = filepath.Join(VtsBackupDir, "vtsbackup.log")
 	Web         WebConfig
+	// Bandwidth global upload limit, nil is unlimited
+	Bandwidth *helper.BandwidthLimit
+	// MaxConcurrentJobs the number of models can be performed at the same time, 0 is unlimited
+	MaxConcurrentJobs int
+	History           HistoryConfig
+	NotifyQueue       NotifyQueueConfig
 
 	wLock = sync.Mutex{}
 
@@ -48,8 +54,56 @@ var (
 	UpdatedAt time.Time
 
 	onConfigChanges = make([]func(fsnotify.Event), 0)
+	// onConfigReloadFails the callbacks with the models before the failed reload
+	onConfigReloadFails = make([]func(models []ModelConfig, err error), 0)
+	// notifierValidators the callbacks to validate the notifiers when the model is loaded
+	notifierValidators = make([]func(notifier SubConfig) error, 0)
 )
 
+// HistoryConfig the run history database
+//
+// history:
+//
+//	keep: 1000
+type HistoryConfig struct {
+	// Keep the number of records per model, 0 is unlimited
+	Keep int
+}
+
+// NotifyQueueConfig the queue of the failed notifications, they are retried by the daemon
+//
+// notify_queue:
+//
+//	enabled: true
+//	delay: 1m
+//	backoff: 2
+//	max_delay: 1h
+//	max_age: 24h
+type NotifyQueueConfig struct {
+	Enabled bool
+	// Delay before the first retry
+	Delay time.Duration
+	// Backoff multiply the delay after each retry
+	Backoff float64
+	// MaxDelay the upper bound of the delay
+	MaxDelay time.Duration
+	// MaxAge the notification is dropped when it's not sent after the age
+	MaxAge time.Duration
+}
+
+// DelayOf return the delay after the nth failed attempt, starts from 1
+func (q NotifyQueueConfig) DelayOf(attempt int) time.Duration {
+	delay := float64(q.Delay)
+	for i := 1; i < attempt; i++ {
+		delay *= q.Backoff
+		if q.MaxDelay > 0 && delay >= float64(q.MaxDelay) {
+			return q.MaxDelay
+		}
+	}
+
+	return time.Duration(delay)
+}
+
 type WebConfig struct {
 	Host     string
 	Port     string
@@ -65,19 +119,67 @@ type ScheduleConfig struct {
 	Every string `json:"every,omitempty"`
 	// At time
 	At string `json:"at,omitempty"`
+	// CatchUp run the missed run on startup, e.g. the daemon was down at the scheduled time
+	CatchUp bool `json:"catch_up,omitempty"`
+	// CatchUpMaxAge the missed run older than it is not caught up, default: 24h
+	CatchUpMaxAge time.Duration `json:"catch_up_max_age,omitempty"`
+	// Jitter the random delay before the scheduled run, to spread the hosts with the same schedule
+	Jitter time.Duration `json:"jitter,omitempty"`
+	// Timezone of cron and at, default: local
+	Timezone string         `json:"timezone,omitempty"`
+	Location *time.Location `json:"-"`
+	// Blackout windows of the day, the scheduled run is deferred to the end of the window
+	Blackout []helper.TimeWindow `json:"blackout,omitempty"`
+	// MaxRuntime the run is cancelled and failed after it, 0 is unlimited
+	MaxRuntime time.Duration `json:"max_runtime,omitempty"`
+	Retry      RetryConfig   `json:"retry,omitempty"`
+}
+
+// RetryConfig of the failed scheduled run
+//
+// retry:
+//
+//	attempts: 3
+//	delay: 5m
+//	backoff: 2
+//	notify: final
+type RetryConfig struct {
+	// Attempts the max number of runs including the first one, 0 or 1 is no retry
+	Attempts int `json:"attempts,omitempty"`
+	// Delay before the first retry, default: 1m
+	Delay time.Duration `json:"delay,omitempty"`
+	// Backoff the multiplier of the delay for each retry, default: 1
+	Backoff float64 `json:"backoff,omitempty"`
+	// Notify the failure of each attempt or the final one only: final, each
+	Notify string `json:"notify,omitempty"`
+}
+
+// DelayOf return the delay before the attempt, the attempt starts from 1
+func (rc RetryConfig) DelayOf(attempt int) time.Duration {
+	delay := float64(rc.Delay)
+	for i := 2; i < attempt; i++ {
+		delay *= rc.Backoff
+	}
+
+	return time.Duration(delay)
 }
 
 func (sc ScheduleConfig) String() string {
 	if sc.Enabled {
+		var s string
 		if len(sc.Cron) > 0 {
-			return fmt.Sprintf("cron %s", sc.Cron)
+			s = fmt.Sprintf("cron %s", sc.Cron)
 		} else {
 			if len(sc.At) > 0 {
-				return fmt.Sprintf("every %s at %s", sc.Every, sc.At)
+				s = fmt.Sprintf("every %s at %s", sc.Every, sc.At)
 			} else {
-				return fmt.Sprintf("every %s", sc.Every)
+				s = fmt.Sprintf("every %s", sc.Every)
 			}
 		}
+		if len(sc.Timezone) > 0 {
+			s += fmt.Sprintf(" (%s)", sc.Timezone)
+		}
+		return s
 	}
 
 	return "disabled"
@@ -96,12 +198,21 @@ type ModelConfig struct {
 	EncryptWith    SubConfig
 	Archive        *viper.Viper
 	Splitter       *viper.Viper
+	Healthcheck    *viper.Viper
 	Storages       map[string]SubConfig
 	Notifiers      map[string]SubConfig
 	DefaultStorage string
 	Viper          *viper.Viper
 	BeforeScript   string
 	AfterScript    string
+	// Overlap policy when the model is triggered while it is running: queue, skip, cancel_previous
+	Overlap string
+	// DependsOn the models run before this model when it is scheduled
+	DependsOn []string
+	// TriggerAfter the models trigger this model when they are succeeded
+	TriggerAfter []string
+	// UpstreamFailure what to do when an upstream model is failed: skip, fail
+	UpstreamFailure string
 }
 
 func getBackupDir() string {
@@ -112,6 +223,32 @@ func getBackupDir() string {
 	return dir
 }
 
+// Overlap policies of the model
+const (
+	// OverlapQueue wait for the running one to finish
+	OverlapQueue = "queue"
+	// OverlapSkip skip the trigger
+	OverlapSkip = "skip"
+	// OverlapCancelPrevious cancel the running one and start a new one
+	OverlapCancelPrevious = "cancel_previous"
+)
+
+// Notify policies of the retry
+const (
+	// RetryNotifyFinal notify the final outcome only
+	RetryNotifyFinal = "final"
+	// RetryNotifyEach notify the failure of each attempt
+	RetryNotifyEach = "each"
+)
+
+// Policies of the model when the upstream model is failed
+const (
+	// UpstreamFailureSkip skip the model
+	UpstreamFailureSkip = "skip"
+	// UpstreamFailureFail report the model as failed, it's recorded in history and notified
+	UpstreamFailureFail = "fail"
+)
+
 // SubConfig sub config info
 type SubConfig struct {
 	Name  string
@@ -151,8 +288,10 @@ func Init(configFile string) error {
 	viper.OnConfigChange(func(in fsnotify.Event) {
 		logger.Info("Config file changed:", in.Name)
 		defer onConfigChanged(in)
+		models := Models
 		if err := loadConfig(); err != nil {
 			logger.Error(err.Error())
+			onConfigReloadFailed(models, err)
 		}
 	})
 
@@ -164,6 +303,23 @@ func OnConfigChange(run func(in fsnotify.Event)) {
 	onConfigChanges = append(onConfigChanges, run)
 }
 
+// OnConfigReloadFail add callback when the changed config is failed to load, the models are the ones before the reload
+func OnConfigReloadFail(run func(models []ModelConfig, err error)) {
+	onConfigReloadFails = append(onConfigReloadFails, run)
+}
+
+// OnNotifierLoad add callback to validate the notifier when the model is loaded, the config is failed to load by the error,
+// e.g. the events are checked by the notifier package
+func OnNotifierLoad(validate func(notifier SubConfig) error) {
+	notifierValidators = append(notifierValidators, validate)
+}
+
+func onConfigReloadFailed(models []ModelConfig, err error) {
+	for _, fn := range onConfigReloadFails {
+		fn(models, err)
+	}
+}
+
 // Invoke callbacks when config changed
 func onConfigChanged(in fsnotify.Event) {
 	for _, fn := range onConfigChanges {
@@ -221,6 +377,13 @@ func loadConfig() error {
 		viper.Set("useTempWorkDir", true)
 	}
 
+	Bandwidth, err = helper.ParseBandwidthLimit(viper.GetString("bandwidth_limit"), viper.GetStringMapString("bandwidth_schedule"))
+	if err != nil {
+		return err
+	}
+
+	MaxConcurrentJobs = viper.GetInt("max_concurrent_jobs")
+
 	Exist = true
 	Models = []ModelConfig{}
 	for key := range viper.GetStringMap("models") {
@@ -236,6 +399,10 @@ func loadConfig() error {
 		return fmt.Errorf("no model found in %s", viperConfigFile)
 	}
 
+	if err := checkDependencies(Models); err != nil {
+		return err
+	}
+
 	// Load web config
 	Web = WebConfig{}
 	viper.SetDefault("web.host", "0.0.0.0")
@@ -245,6 +412,29 @@ func loadConfig() error {
 	Web.Username = viper.GetString("web.username")
 	Web.Password = viper.GetString("web.password")
 
+	// Load history config
+	viper.SetDefault("history.keep", 1000)
+	History = HistoryConfig{
+		Keep: viper.GetInt("history.keep"),
+	}
+
+	// Load notify queue config
+	viper.SetDefault("notify_queue.enabled", true)
+	viper.SetDefault("notify_queue.delay", "1m")
+	viper.SetDefault("notify_queue.backoff", 2)
+	viper.SetDefault("notify_queue.max_delay", "1h")
+	viper.SetDefault("notify_queue.max_age", "24h")
+	NotifyQueue = NotifyQueueConfig{
+		Enabled:  viper.GetBool("notify_queue.enabled"),
+		Delay:    viper.GetDuration("notify_queue.delay"),
+		Backoff:  viper.GetFloat64("notify_queue.backoff"),
+		MaxDelay: viper.GetDuration("notify_queue.max_delay"),
+		MaxAge:   viper.GetDuration("notify_queue.max_age"),
+	}
+	if NotifyQueue.Backoff < 1 {
+		NotifyQueue.Backoff = 1
+	}
+
 	UpdatedAt = time.Now()
 	logger.Infof("Config loaded, found %d models.", len(Models))
 
@@ -277,35 +467,122 @@ func loadModel(key string) (ModelConfig, error) {
 
 	model.Archive = model.Viper.Sub("archive")
 	model.Splitter = model.Viper.Sub("split_with")
+	model.Healthcheck = model.Viper.Sub("healthcheck")
 
 	model.BeforeScript = model.Viper.GetString("before_script")
 	model.AfterScript = model.Viper.GetString("after_script")
 
-	loadScheduleConfig(&model)
+	model.DependsOn = model.Viper.GetStringSlice("depends_on")
+	model.TriggerAfter = model.Viper.GetStringSlice("trigger_after")
+	model.Viper.SetDefault("upstream_failure", UpstreamFailureSkip)
+	model.UpstreamFailure = model.Viper.GetString("upstream_failure")
+	if model.UpstreamFailure != UpstreamFailureSkip && model.UpstreamFailure != UpstreamFailureFail {
+		return ModelConfig{}, fmt.Errorf("upstream_failure %q is not supported, must be one of: %s, %s", model.UpstreamFailure, UpstreamFailureSkip, UpstreamFailureFail)
+	}
+
+	model.Viper.SetDefault("overlap", OverlapQueue)
+	model.Overlap = model.Viper.GetString("overlap")
+	switch model.Overlap {
+	case OverlapQueue, OverlapSkip, OverlapCancelPrevious:
+	default:
+		return ModelConfig{}, fmt.Errorf("overlap %q is not supported, must be one of: %s, %s, %s", model.Overlap, OverlapQueue, OverlapSkip, OverlapCancelPrevious)
+	}
+
+	if err := loadScheduleConfig(&model); err != nil {
+		return ModelConfig{}, err
+	}
 	loadStoragesConfig(&model)
 
 	if len(model.Storages) == 0 {
 		return ModelConfig{}, fmt.Errorf("no storage found in model %s", model.Name)
 	}
 
-	loadNotifiersConfig(&model)
+	for key, storage := range model.Storages {
+		if _, err := BandwidthLimitFor(storage.Viper); err != nil {
+			return ModelConfig{}, fmt.Errorf("storage %s: %v", key, err)
+		}
+	}
+
+	if err := loadNotifiersConfig(&model); err != nil {
+		return ModelConfig{}, err
+	}
 
 	return model, nil
 }
 
-func loadScheduleConfig(model *ModelConfig) {
+func loadScheduleConfig(model *ModelConfig) error {
 	subViper := model.Viper.Sub("schedule")
 	model.Schedule = ScheduleConfig{Enabled: false}
 	if subViper == nil {
-		return
+		return nil
+	}
+
+	subViper.SetDefault("catch_up_max_age", "24h")
+
+	schedule := ScheduleConfig{
+		Enabled:  true,
+		Cron:     subViper.GetString("cron"),
+		Every:    subViper.GetString("every"),
+		At:       subViper.GetString("at"),
+		CatchUp:  subViper.GetBool("catch_up"),
+		Timezone: subViper.GetString("timezone"),
+		Location: time.Local,
+	}
+
+	durations := map[string]*time.Duration{
+		"catch_up_max_age": &schedule.CatchUpMaxAge,
+		"jitter":           &schedule.Jitter,
+		"max_runtime":      &schedule.MaxRuntime,
+	}
+	for key, d := range durations {
+		if value := subViper.GetString(key); len(value) > 0 {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("schedule.%s: %v", key, err)
+			}
+			*d = parsed
+		}
 	}
 
-	model.Schedule = ScheduleConfig{
-		Enabled: true,
-		Cron:    subViper.GetString("cron"),
-		Every:   subViper.GetString("every"),
-		At:      subViper.GetString("at"),
+	if len(schedule.Timezone) > 0 {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return fmt.Errorf("schedule.timezone: %v", err)
+		}
+		schedule.Location = location
+	}
+
+	subViper.SetDefault("retry.delay", "1m")
+	subViper.SetDefault("retry.backoff", 1)
+	subViper.SetDefault("retry.notify", RetryNotifyFinal)
+	retryDelay, err := time.ParseDuration(subViper.GetString("retry.delay"))
+	if err != nil {
+		return fmt.Errorf("schedule.retry.delay: %v", err)
+	}
+	schedule.Retry = RetryConfig{
+		Attempts: subViper.GetInt("retry.attempts"),
+		Delay:    retryDelay,
+		Backoff:  subViper.GetFloat64("retry.backoff"),
+		Notify:   subViper.GetString("retry.notify"),
 	}
+	if schedule.Retry.Backoff < 1 {
+		return fmt.Errorf("schedule.retry.backoff: must be greater than or equal to 1")
+	}
+	if schedule.Retry.Notify != RetryNotifyFinal && schedule.Retry.Notify != RetryNotifyEach {
+		return fmt.Errorf("schedule.retry.notify %q is not supported, must be one of: %s, %s", schedule.Retry.Notify, RetryNotifyFinal, RetryNotifyEach)
+	}
+
+	for _, window := range subViper.GetStringSlice("blackout") {
+		tw, err := helper.ParseTimeWindow(window)
+		if err != nil {
+			return fmt.Errorf("schedule.blackout: %v", err)
+		}
+		schedule.Blackout = append(schedule.Blackout, tw)
+	}
+
+	model.Schedule = schedule
+
+	return nil
 }
 
 func loadStoragesConfig(model *ModelConfig) {
@@ -330,17 +607,48 @@ func loadStoragesConfig(model *ModelConfig) {
 	model.Storages = storageConfigs
 }
 
-func loadNotifiersConfig(model *ModelConfig) {
+func loadNotifiersConfig(model *ModelConfig) error {
 	subViper := model.Viper.Sub("notifiers")
 	model.Notifiers = map[string]SubConfig{}
 	for key := range model.Viper.GetStringMap("notifiers") {
 		dbViper := subViper.Sub(key)
-		model.Notifiers[key] = SubConfig{
+		notifier := SubConfig{
 			Name:  key,
 			Type:  dbViper.GetString("type"),
 			Viper: dbViper,
 		}
+
+		for _, validate := range notifierValidators {
+			if err := validate(notifier); err != nil {
+				return err
+			}
+		}
+		model.Notifiers[key] = notifier
 	}
+
+	return nil
+}
+
+// BandwidthLimitFor return the bandwidth limit of the storage,
+// `bandwidth_limit` and `bandwidth_schedule` fallback to the global config separately
+func BandwidthLimitFor(storageViper *viper.Viper) (*helper.BandwidthLimit, error) {
+	if storageViper == nil || !(storageViper.IsSet("bandwidth_limit") || storageViper.IsSet("bandwidth_schedule")) {
+		return Bandwidth, nil
+	}
+
+	bl, err := helper.ParseBandwidthLimit(storageViper.GetString("bandwidth_limit"), storageViper.GetStringMapString("bandwidth_schedule"))
+	if err != nil || bl == nil || Bandwidth == nil {
+		return bl, err
+	}
+
+	if !storageViper.IsSet("bandwidth_limit") {
+		bl.Rate = Bandwidth.Rate
+	}
+	if !storageViper.IsSet("bandwidth_schedule") {
+		bl.Schedules = Bandwidth.Schedules
+	}
+
+	return bl, nil
 }
 
 // GetModelConfigByName get model config by name
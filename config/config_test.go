@@ -16,10 +16,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -71,6 +74,11 @@ func TestModel(t *testing.T) {
 	schedule := model.Schedule
 	assert.Equal(t, true, schedule.Enabled)
 	assert.Equal(t, "0 0 * * *", schedule.Cron)
+	assert.Equal(t, false, schedule.CatchUp)
+	assert.Equal(t, 24*time.Hour, schedule.CatchUpMaxAge)
+	assert.Equal(t, time.Local, schedule.Location)
+	assert.Equal(t, RetryConfig{Delay: time.Minute, Backoff: 1, Notify: RetryNotifyFinal}, schedule.Retry)
+	assert.Empty(t, schedule.Blackout)
 }
 
 func Test_otherModels(t *testing.T) {
@@ -85,9 +93,23 @@ func Test_otherModels(t *testing.T) {
 	assert.Equal(t, "", schedule.Cron)
 	assert.Equal(t, "1day", schedule.Every)
 	assert.Equal(t, "0:30", schedule.At)
+	assert.Equal(t, true, schedule.CatchUp)
+	assert.Equal(t, 12*time.Hour, schedule.CatchUpMaxAge)
+	assert.Equal(t, 10*time.Minute, schedule.Jitter)
+	assert.Equal(t, "Asia/Ho_Chi_Minh", schedule.Location.String())
+	assert.Equal(t, []helper.TimeWindow{{Start: 8 * time.Hour, End: 18 * time.Hour}}, schedule.Blackout)
+	assert.Equal(t, 2*time.Hour, schedule.MaxRuntime)
+	assert.Equal(t, RetryConfig{Attempts: 3, Delay: 5 * time.Minute, Backoff: 2, Notify: RetryNotifyFinal}, schedule.Retry)
+	assert.Equal(t, 5*time.Minute, schedule.Retry.DelayOf(2))
+	assert.Equal(t, 10*time.Minute, schedule.Retry.DelayOf(3))
+
+	assert.Equal(t, OverlapQueue, model.Overlap)
 
 	model = GetModelConfigByName("test_model")
 	assert.Equal(t, false, model.Schedule.Enabled)
+	assert.Equal(t, OverlapSkip, model.Overlap)
+	assert.Equal(t, []string{"test"}, model.DependsOn)
+	assert.Equal(t, UpstreamFailureSkip, model.UpstreamFailure)
 }
 
 func Test_ScheduleConfig_String(t *testing.T) {
@@ -111,6 +133,9 @@ func Test_ScheduleConfig_String(t *testing.T) {
 
 	assert.Equal(t, schedule.String(), "cron 5 4 * * sun")
 
+	schedule.Timezone = "Asia/Ho_Chi_Minh"
+	assert.Equal(t, schedule.String(), "cron 5 4 * * sun (Asia/Ho_Chi_Minh)")
+
 	schedule = ScheduleConfig{
 		Enabled: false,
 	}
@@ -132,6 +157,53 @@ func TestWebConfig(t *testing.T) {
 	assert.Equal(t, Web.Password, "admin")
 }
 
+func TestBandwidthLimitFor(t *testing.T) {
+	assert.Equal(t, int64(20*1024*1024), Bandwidth.Rate)
+
+	model := GetModelConfigByName("test_model")
+	bl, err := BandwidthLimitFor(model.Storages["ftp"].Viper)
+	assert.NoError(t, err)
+	assert.Equal(t, Bandwidth, bl)
+
+	model = GetModelConfigByName("normal_files")
+	bl, err = BandwidthLimitFor(model.Storages["scp"].Viper)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20*1024*1024), bl.Rate)
+	assert.Equal(t, int64(5*1024*1024), bl.RateAt(time.Date(2024, 9, 21, 12, 0, 0, 0, time.Local)))
+}
+
+func Test_loadNotifiersConfig(t *testing.T) {
+	validators := notifierValidators
+	defer func() { notifierValidators = validators }()
+
+	model := ModelConfig{Viper: viper.New()}
+	model.Viper.Set("notifiers.slack.type", "slack")
+	model.Viper.Set("notifiers.slack.events", []string{"finished"})
+	assert.NoError(t, loadNotifiersConfig(&model))
+	assert.Equal(t, "slack", model.Notifiers["slack"].Type)
+
+	// The config is failed to load by the validators
+	OnNotifierLoad(func(notifier SubConfig) error {
+		return fmt.Errorf("Notifier: %s has unknown event %q", notifier.Name, notifier.Viper.GetStringSlice("events")[0])
+	})
+	assert.EqualError(t, loadNotifiersConfig(&model), `Notifier: slack has unknown event "finished"`)
+}
+
+func TestHistoryConfig(t *testing.T) {
+	assert.Equal(t, 1000, History.Keep)
+}
+
+func TestNotifyQueueConfig(t *testing.T) {
+	queue := NotifyQueue
+	assert.Equal(t, true, queue.Enabled)
+	assert.Equal(t, time.Minute, queue.Delay)
+	assert.Equal(t, 24*time.Hour, queue.MaxAge)
+
+	assert.Equal(t, time.Minute, queue.DelayOf(1))
+	assert.Equal(t, 4*time.Minute, queue.DelayOf(3))
+	assert.Equal(t, time.Hour, queue.DelayOf(10))
+}
+
 func TestInitWithNotExistsConfigFile(t *testing.T) {
 	err := Init("config/path/not-exist.yml")
 	assert.NotNil(t, err)
@@ -0,0 +1,98 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkDependencies check the models in `depends_on` and `trigger_after` exist, and there is no cycle
+func checkDependencies(models []ModelConfig) error {
+	upstreams := map[string][]string{}
+	for _, model := range models {
+		upstreams[model.Name] = append(append([]string{}, model.DependsOn...), model.TriggerAfter...)
+	}
+
+	for _, model := range models {
+		for _, name := range upstreams[model.Name] {
+			if _, ok := upstreams[name]; !ok {
+				return fmt.Errorf("model %s: upstream model %s not found", model.Name, name)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		switch states[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		states[name] = visiting
+		for _, upstream := range upstreams[name] {
+			if err := visit(upstream, path); err != nil {
+				return err
+			}
+		}
+		states[name] = visited
+
+		return nil
+	}
+
+	// Sort for the stable error message
+	names := make([]string, 0, len(upstreams))
+	for name := range upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TriggeredAfter return the models have the model in `trigger_after`, sorted by name
+func TriggeredAfter(name string) (models []ModelConfig) {
+	for _, model := range Models {
+		for _, upstream := range model.TriggerAfter {
+			if upstream == name {
+				models = append(models, model)
+				break
+			}
+		}
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+
+	return
+}
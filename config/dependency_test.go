@@ -0,0 +1,53 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	models := []ModelConfig{
+		{Name: "db"},
+		{Name: "app", DependsOn: []string{"db"}},
+		{Name: "replicate", TriggerAfter: []string{"app"}},
+	}
+	assert.NoError(t, checkDependencies(models))
+
+	models = append(models, ModelConfig{Name: "foo", DependsOn: []string{"bar"}})
+	assert.EqualError(t, checkDependencies(models), "model foo: upstream model bar not found")
+
+	models = []ModelConfig{
+		{Name: "a", DependsOn: []string{"c"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", TriggerAfter: []string{"b"}},
+	}
+	assert.EqualError(t, checkDependencies(models), "dependency cycle: a -> c -> b -> a")
+
+	models = []ModelConfig{{Name: "a", DependsOn: []string{"a"}}}
+	assert.EqualError(t, checkDependencies(models), "dependency cycle: a -> a")
+}
+
+func TestTriggeredAfter(t *testing.T) {
+	models := TriggeredAfter("test")
+	assert.Len(t, models, 1)
+	assert.Equal(t, "normal_files", models[0].Name)
+	assert.Equal(t, UpstreamFailureFail, models[0].UpstreamFailure)
+
+	assert.Empty(t, TriggeredAfter("normal_files"))
+}
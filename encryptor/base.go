@@ -16,8 +16,10 @@
 package encryptor
 
 import (
+	"context"
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/spf13/viper"
 )
 
@@ -30,7 +32,7 @@ type Base struct {
 
 // Encryptor interface
 type Encryptor interface {
-	perform() (encryptPath string, err error)
+	perform(ctx context.Context) (encryptPath string, err error)
 }
 
 func newBase(archivePath string, model config.ModelConfig) (base *Base) {
@@ -43,8 +45,8 @@ func newBase(archivePath string, model config.ModelConfig) (base *Base) {
 }
 
 // Run compressor
-func Run(archivePath string, model config.ModelConfig) (encryptPath string, err error) {
-	logger := logger.Tag("Encryptor")
+func Run(ctx context.Context, archivePath string, model config.ModelConfig, rr *result.RunResult) (encryptPath string, err error) {
+	logger := logger.TagContext(ctx, "Encryptor")
 
 	base := newBase(archivePath, model)
 	var enc Encryptor
@@ -57,11 +59,12 @@ func Run(archivePath string, model config.ModelConfig) (encryptPath string, err
 	}
 
 	logger.Info("encrypt: " + model.EncryptWith.Type)
-	encryptPath, err = enc.perform()
+	encryptPath, err = enc.perform(ctx)
 	if err != nil {
 		return
 	}
 	logger.Info("encrypted:", encryptPath)
+	rr.SetArchive(encryptPath)
 
 	// save Extension
 	model.Viper.Set("Ext", model.Viper.GetString("Ext")+".enc")
@@ -16,6 +16,7 @@
 package encryptor
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -56,7 +57,7 @@ func NewOpenSSL(base *Base) *OpenSSL {
 	}
 }
 
-func (enc *OpenSSL) perform() (encryptPath string, err error) {
+func (enc *OpenSSL) perform(ctx context.Context) (encryptPath string, err error) {
 	if len(enc.password) == 0 {
 		err = fmt.Errorf("password option is required")
 		return
@@ -64,7 +65,7 @@ func (enc *OpenSSL) perform() (encryptPath string, err error) {
 
 	opts := enc.options()
 	opts = append(opts, "-in", enc.archivePath, "-out", enc.encryptPath)
-	_, err = helper.Exec("openssl", opts...)
+	_, err = helper.ExecContext(ctx, "openssl", opts...)
 	if err != nil {
 		err = fmt.Errorf("OpenSSL encrypt failed: %s `openssl %s`", strings.TrimSpace(err.Error()), strings.Join(opts, " "))
 		return "", err
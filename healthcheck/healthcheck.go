@@ -0,0 +1,126 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package healthcheck
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/logger"
+)
+
+// Healthcheck ping the dead man's switch service (healthchecks.io, Uptime Kuma...),
+// the service alerts when the ping is missing, even if the daemon is down.
+//
+// healthcheck:
+//
+//	url: https://hc-ping.com/your-uuid
+//	send_log: true
+//	log_lines: 100
+//	timeout: 10s
+//
+// It pings `{url}/start` when the run is started, `{url}` when it is succeeded and `{url}/fail` when it is failed.
+type Healthcheck struct {
+	url      string
+	sendLog  bool
+	logLines int
+	client   *http.Client
+}
+
+const (
+	pingStart   = "/start"
+	pingSuccess = ""
+	pingFail    = "/fail"
+)
+
+func new(model config.ModelConfig) *Healthcheck {
+	if model.Healthcheck == nil {
+		return nil
+	}
+
+	v := model.Healthcheck
+	v.SetDefault("log_lines", 100)
+	v.SetDefault("timeout", "10s")
+
+	url := strings.TrimSuffix(v.GetString("url"), "/")
+	if len(url) == 0 {
+		return nil
+	}
+
+	return &Healthcheck{
+		url:      url,
+		sendLog:  v.GetBool("send_log"),
+		logLines: v.GetInt("log_lines"),
+		client:   &http.Client{Timeout: v.GetDuration("timeout")},
+	}
+}
+
+// Start ping the start of the run
+func Start(model config.ModelConfig) {
+	new(model).ping(model.Name, pingStart, "")
+}
+
+// Finish ping the outcome of the run, with the tail of the log of the run when `send_log` is enabled
+func Finish(model config.ModelConfig, runID string, err error) {
+	hc := new(model)
+	if hc == nil {
+		return
+	}
+
+	var body string
+	if hc.sendLog {
+		body = strings.Join(logger.RunTail(runID, hc.logLines), "\n")
+	}
+
+	if err != nil {
+		hc.ping(model.Name, pingFail, body)
+	} else {
+		hc.ping(model.Name, pingSuccess, body)
+	}
+}
+
+// ping the url with the path, the error is logged and never fails the run
+func (hc *Healthcheck) ping(name, path, body string) {
+	if hc == nil {
+		return
+	}
+
+	logger := logger.Tag(fmt.Sprintf("Healthcheck: %s", name))
+
+	if err := hc.post(hc.url+path, body); err != nil {
+		logger.Errorf("Failed to ping %s: %v", hc.url+path, err)
+		return
+	}
+	logger.Infof("Pinged %s", hc.url+path)
+}
+
+func (hc *Healthcheck) post(url, body string) error {
+	resp, err := hc.client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/logger"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type ping struct {
+	path string
+	body string
+}
+
+func setupServer(t *testing.T, status int) (*httptest.Server, func() []ping) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var pings []ping
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		pings = append(pings, ping{path: r.URL.Path, body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []ping {
+		mu.Lock()
+		defer mu.Unlock()
+		return pings
+	}
+}
+
+func newModel(url string, sendLog bool) config.ModelConfig {
+	v := viper.New()
+	v.Set("url", url)
+	v.Set("send_log", sendLog)
+	v.Set("log_lines", 1)
+
+	return config.ModelConfig{Name: "foo", Healthcheck: v}
+}
+
+func TestPing(t *testing.T) {
+	server, pings := setupServer(t, 200)
+	model := newModel(server.URL+"/uuid/", false)
+
+	Start(model)
+	Finish(model, "abc", nil)
+	Finish(model, "abc", errors.New("boom"))
+
+	assert.Equal(t, []ping{
+		{path: "/uuid/start"},
+		{path: "/uuid"},
+		{path: "/uuid/fail"},
+	}, pings())
+}
+
+func TestPing_sendLog(t *testing.T) {
+	server, pings := setupServer(t, 200)
+	model := newModel(server.URL, true)
+
+	ctx, end := logger.WithRun(context.Background(), "abc")
+	defer end()
+	otherCtx, otherEnd := logger.WithRun(context.Background(), "def")
+	defer otherEnd()
+
+	logger.TagContext(ctx, "Test").Info("upload failed")
+	// The lines of the other run are not sent
+	logger.TagContext(otherCtx, "Test").Info("/secret/path of other model")
+	Finish(model, "abc", errors.New("upload failed"))
+
+	assert.Len(t, pings(), 1)
+	assert.Equal(t, "/fail", pings()[0].path)
+	assert.Contains(t, pings()[0].body, "upload failed")
+	assert.NotContains(t, pings()[0].body, "other model")
+}
+
+func TestPing_disabled(t *testing.T) {
+	assert.Nil(t, new(config.ModelConfig{Name: "foo"}))
+	assert.Nil(t, new(newModel("", false)))
+
+	// Not panic
+	Start(config.ModelConfig{Name: "foo"})
+	Finish(config.ModelConfig{Name: "foo"}, "abc", nil)
+}
+
+func TestPost(t *testing.T) {
+	server, _ := setupServer(t, 404)
+	hc := new(newModel(server.URL, false))
+
+	assert.EqualError(t, hc.post(server.URL, ""), "status: 404, body: ")
+}
@@ -0,0 +1,176 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package helper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// BandwidthLimit limit the upload rate in bytes per second, with optional time-of-day schedules
+//
+// bandwidth_limit: 20MiB/s
+// bandwidth_schedule:
+//
+//	"08:00-18:00": 5MiB/s
+type BandwidthLimit struct {
+	// Rate in bytes per second, 0 is unlimited
+	Rate      int64
+	Schedules []BandwidthSchedule
+}
+
+// BandwidthSchedule the rate in the time window of the day
+type BandwidthSchedule struct {
+	TimeWindow
+	Rate int64
+}
+
+// ParseBandwidthLimit parse the limit and schedules, return nil when there is no limit
+func ParseBandwidthLimit(limit string, schedules map[string]string) (*BandwidthLimit, error) {
+	if len(strings.TrimSpace(limit)) == 0 && len(schedules) == 0 {
+		return nil, nil
+	}
+
+	rate, err := ParseRate(limit)
+	if err != nil {
+		return nil, fmt.Errorf("bandwidth_limit: %v", err)
+	}
+
+	bl := &BandwidthLimit{Rate: rate}
+	for window, value := range schedules {
+		tw, err := ParseTimeWindow(window)
+		if err != nil {
+			return nil, fmt.Errorf("bandwidth_schedule: %v", err)
+		}
+
+		rate, err := ParseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("bandwidth_schedule %q: %v", window, err)
+		}
+
+		bl.Schedules = append(bl.Schedules, BandwidthSchedule{TimeWindow: tw, Rate: rate})
+	}
+
+	// Make the matching order stable
+	sort.Slice(bl.Schedules, func(i, j int) bool {
+		return bl.Schedules[i].Start < bl.Schedules[j].Start
+	})
+
+	return bl, nil
+}
+
+// ParseRate parse rate like `20MiB/s`, `512KB/s` or `1048576` to bytes per second, empty or 0 is unlimited
+func ParseRate(rate string) (int64, error) {
+	rate = strings.TrimSpace(rate)
+	rate = strings.TrimSuffix(rate, "/s")
+	if len(rate) == 0 {
+		return 0, nil
+	}
+
+	bytes, err := humanize.ParseBytes(rate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, e.g. 20MiB/s", rate)
+	}
+
+	return int64(bytes), nil
+}
+
+// RateAt return the rate at the time, 0 is unlimited
+func (bl *BandwidthLimit) RateAt(t time.Time) int64 {
+	if bl == nil {
+		return 0
+	}
+
+	for _, schedule := range bl.Schedules {
+		if schedule.In(t) {
+			return schedule.Rate
+		}
+	}
+
+	return bl.Rate
+}
+
+func (bl *BandwidthLimit) String() string {
+	if bl == nil {
+		return "unlimited"
+	}
+
+	rate := bl.RateAt(time.Now())
+	if rate == 0 {
+		return "unlimited"
+	}
+
+	return humanize.IBytes(uint64(rate)) + "/s"
+}
+
+// Reader wrap the reader to limit the read rate
+func (bl *BandwidthLimit) Reader(reader io.Reader) io.Reader {
+	if bl == nil {
+		return reader
+	}
+
+	return &throttledReader{reader: reader, limit: bl}
+}
+
+type throttledReader struct {
+	reader io.Reader
+	limit  *BandwidthLimit
+
+	// Token bucket, the tokens are the bytes allowed to read. It's capped at one chunk,
+	// so the budget is not saved up by a stall (e.g. a slow remote) to burst above the rate after it.
+	tokens     float64
+	lastRefill time.Time
+}
+
+// bandwidthInterval read at most the data of the interval at once to keep the rate smooth
+const bandwidthInterval = 100 * time.Millisecond
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	now := time.Now()
+	rate := r.limit.RateAt(now)
+	if rate <= 0 {
+		return r.reader.Read(p)
+	}
+
+	chunk := max(int64(float64(rate)*bandwidthInterval.Seconds()), 1)
+
+	// The bucket is empty at the start
+	if !r.lastRefill.IsZero() {
+		r.tokens += now.Sub(r.lastRefill).Seconds() * float64(rate)
+	}
+	r.lastRefill = now
+	// The rate may be changed by the schedules, cap by the current one
+	r.tokens = min(r.tokens, float64(chunk))
+
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := r.reader.Read(p)
+	r.tokens -= float64(n)
+
+	// Wait for the debt, the waited time refills the bucket at the next read
+	if r.tokens < 0 {
+		time.Sleep(time.Duration(-r.tokens / float64(rate) * float64(time.Second)))
+	}
+
+	return n, err
+}
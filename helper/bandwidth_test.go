@@ -0,0 +1,122 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package helper
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"":         0,
+		"0":        0,
+		"20MiB/s":  20 * 1024 * 1024,
+		"512KB/s":  512 * 1000,
+		"1048576":  1048576,
+		" 5MiB/s ": 5 * 1024 * 1024,
+	}
+
+	for rate, expected := range cases {
+		actual, err := ParseRate(rate)
+		assert.NoError(t, err, rate)
+		assert.Equal(t, expected, actual, rate)
+	}
+
+	_, err := ParseRate("fast")
+	assert.EqualError(t, err, `invalid rate "fast", e.g. 20MiB/s`)
+}
+
+func TestParseBandwidthLimit(t *testing.T) {
+	bl, err := ParseBandwidthLimit("", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, bl)
+	assert.Equal(t, "unlimited", bl.String())
+	assert.Equal(t, int64(0), bl.RateAt(time.Now()))
+
+	bl, err = ParseBandwidthLimit("20MiB/s", map[string]string{
+		"22:00-06:00": "50MiB/s",
+		"08:00-18:00": "5MiB/s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20*1024*1024), bl.Rate)
+	assert.Len(t, bl.Schedules, 2)
+	assert.Equal(t, 8*time.Hour, bl.Schedules[0].Start)
+
+	day := func(hour, minute int) time.Time {
+		return time.Date(2024, 9, 21, hour, minute, 0, 0, time.Local)
+	}
+	assert.Equal(t, int64(5*1024*1024), bl.RateAt(day(8, 0)))
+	assert.Equal(t, int64(5*1024*1024), bl.RateAt(day(17, 59)))
+	assert.Equal(t, int64(20*1024*1024), bl.RateAt(day(18, 0)))
+	assert.Equal(t, int64(50*1024*1024), bl.RateAt(day(23, 30)))
+	assert.Equal(t, int64(50*1024*1024), bl.RateAt(day(2, 0)))
+	assert.Equal(t, int64(20*1024*1024), bl.RateAt(day(7, 0)))
+
+	_, err = ParseBandwidthLimit("20MiB/s", map[string]string{"08:00": "5MiB/s"})
+	assert.EqualError(t, err, `bandwidth_schedule: invalid time window "08:00", e.g. 08:00-18:00`)
+
+	_, err = ParseBandwidthLimit("20MiB/s", map[string]string{"08:00-25:00": "5MiB/s"})
+	assert.EqualError(t, err, `bandwidth_schedule: invalid time window "08:00-25:00": invalid time "25:00"`)
+
+	_, err = ParseBandwidthLimit("fast", nil)
+	assert.EqualError(t, err, `bandwidth_limit: invalid rate "fast", e.g. 20MiB/s`)
+}
+
+func TestBandwidthLimit_Reader(t *testing.T) {
+	data := []byte(strings.Repeat("a", 20*1000))
+
+	var bl *BandwidthLimit
+	assert.Equal(t, io.Reader(bytes.NewReader(data)), bl.Reader(bytes.NewReader(data)))
+
+	bl = &BandwidthLimit{Rate: 100 * 1000}
+
+	start := time.Now()
+	out, err := io.ReadAll(bl.Reader(bytes.NewReader(data)))
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+	// 20KB at 100KB/s
+	assert.GreaterOrEqual(t, elapsed, 180*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestBandwidthLimit_ReaderAfterStall(t *testing.T) {
+	data := []byte(strings.Repeat("a", 20*1000))
+	bl := &BandwidthLimit{Rate: 100 * 1000}
+
+	reader := bl.Reader(io.MultiReader(bytes.NewReader([]byte("a")), bytes.NewReader(data)))
+	_, err := reader.Read(make([]byte, 1))
+	assert.NoError(t, err)
+
+	// The budget is not saved up by the stall
+	time.Sleep(300 * time.Millisecond)
+
+	start := time.Now()
+	out, err := io.ReadAll(reader)
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+	// 20KB at 100KB/s, the first 10KB is the burst of one interval
+	assert.GreaterOrEqual(t, elapsed, 90*time.Millisecond)
+}
@@ -17,6 +17,7 @@ package helper
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -36,8 +37,24 @@ func Exec(command string, args ...string) (output string, err error) {
 	return ExecWithStdio(command, false, args...)
 }
 
+// ExecContext cli commands, the command is killed when ctx is done
+func ExecContext(ctx context.Context, command string, args ...string) (output string, err error) {
+	output, _, err = execWithStdio(ctx, command, false, args...)
+	return
+}
+
+// ExecContextWithStderr cli commands, return the stderr even if the command is succeeded, e.g. the warnings
+func ExecContextWithStderr(ctx context.Context, command string, args ...string) (output, stderr string, err error) {
+	return execWithStdio(ctx, command, false, args...)
+}
+
 // ExecWithStdio cli commands with stdio
 func ExecWithStdio(command string, stdout bool, args ...string) (output string, err error) {
+	output, _, err = execWithStdio(context.Background(), command, stdout, args...)
+	return
+}
+
+func execWithStdio(ctx context.Context, command string, stdout bool, args ...string) (output, stderr string, err error) {
 	commands := spaceRegexp.Split(command, -1)
 	command = commands[0]
 	commandArgs := []string{}
@@ -50,10 +67,10 @@ func ExecWithStdio(command string, stdout bool, args ...string) (output string,
 
 	fullCommand, err := exec.LookPath(command)
 	if err != nil {
-		return "", fmt.Errorf("%s cannot be found", command)
+		return "", "", fmt.Errorf("%s cannot be found", command)
 	}
 
-	cmd := exec.Command(fullCommand, commandArgs...)
+	cmd := exec.CommandContext(ctx, fullCommand, commandArgs...)
 	cmd.Env = os.Environ()
 
 	var stdErr bytes.Buffer
@@ -69,9 +86,13 @@ func ExecWithStdio(command string, stdout bool, args ...string) (output string,
 	err = cmd.Run()
 	if err != nil {
 		logger.Debug(fullCommand, " ", strings.Join(commandArgs, " "))
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
 		err = errors.New(stdErr.String())
 	}
 	output = strings.Trim(stdOut.String(), "\n")
+	stderr = stdErr.String()
 
 	return
 }
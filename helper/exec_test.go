@@ -1,7 +1,9 @@
 package helper
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -38,3 +40,24 @@ func TestExecWithStdio(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Empty(t, out)
 }
+
+func TestExecContext(t *testing.T) {
+	out, err := ExecContext(context.Background(), "head -n1", "./exec_test.go")
+	assert.Nil(t, err)
+	assert.Equal(t, out, "package helper")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = ExecContext(ctx, "sleep", "10")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecContextWithStderr(t *testing.T) {
+	out, stderr, err := ExecContextWithStderr(context.Background(), "sh", "-c", "echo foo; echo bar >&2")
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", out)
+	assert.Equal(t, "bar\n", stderr)
+}
@@ -0,0 +1,34 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build !unix
+
+package helper
+
+import "os"
+
+// The file lock is not supported on the platform, only the locks in the process are held
+
+func TryLockFile(f *os.File) error {
+	return nil
+}
+
+func LockFile(f *os.File) error {
+	return nil
+}
+
+func UnlockFile(f *os.File) error {
+	return nil
+}
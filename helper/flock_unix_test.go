@@ -0,0 +1,48 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build unix
+
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.lock")
+
+	f1, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	defer f1.Close()
+	f2, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	defer f2.Close()
+
+	assert.NoError(t, TryLockFile(f1))
+	assert.ErrorIs(t, TryLockFile(f2), ErrLocked)
+
+	assert.NoError(t, UnlockFile(f1))
+	assert.NoError(t, TryLockFile(f2))
+	assert.NoError(t, UnlockFile(f2))
+
+	assert.NoError(t, LockFile(f1))
+	assert.ErrorIs(t, TryLockFile(f2), ErrLocked)
+	assert.NoError(t, UnlockFile(f1))
+}
@@ -0,0 +1,93 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package helper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow between Start and End in the day, End may be less than Start to cross midnight
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseTimeWindow parse `08:00-18:00` into offsets in the day
+func ParseTimeWindow(window string) (tw TimeWindow, err error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return tw, fmt.Errorf("invalid time window %q, e.g. 08:00-18:00", window)
+	}
+
+	if tw.Start, err = parseTimeOfDay(parts[0]); err != nil {
+		return tw, fmt.Errorf("invalid time window %q: %v", window, err)
+	}
+	if tw.End, err = parseTimeOfDay(parts[1]); err != nil {
+		return tw, fmt.Errorf("invalid time window %q: %v", window, err)
+	}
+
+	return tw, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func offsetOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// In check the time of day is in the window
+func (tw TimeWindow) In(t time.Time) bool {
+	offset := offsetOfDay(t)
+
+	if tw.Start <= tw.End {
+		return offset >= tw.Start && offset < tw.End
+	}
+
+	// cross midnight, 22:00-06:00
+	return offset >= tw.Start || offset < tw.End
+}
+
+// Remaining return the duration from t to the end of the window, 0 if t is not in the window
+func (tw TimeWindow) Remaining(t time.Time) time.Duration {
+	if !tw.In(t) {
+		return 0
+	}
+
+	remaining := tw.End - offsetOfDay(t)
+	if remaining <= 0 {
+		remaining += 24 * time.Hour
+	}
+
+	return remaining
+}
+
+// MarshalText marshal the window as `08:00-18:00`
+func (tw TimeWindow) MarshalText() ([]byte, error) {
+	return []byte(tw.String()), nil
+}
+
+func (tw TimeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(tw.Start.Hours()), int(tw.Start.Minutes())%60, int(tw.End.Hours()), int(tw.End.Minutes())%60)
+}
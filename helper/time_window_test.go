@@ -0,0 +1,55 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	tw, err := ParseTimeWindow("08:00-18:30")
+	assert.NoError(t, err)
+	assert.Equal(t, TimeWindow{Start: 8 * time.Hour, End: 18*time.Hour + 30*time.Minute}, tw)
+	assert.Equal(t, "08:00-18:30", tw.String())
+
+	_, err = ParseTimeWindow("08:00")
+	assert.EqualError(t, err, `invalid time window "08:00", e.g. 08:00-18:00`)
+	_, err = ParseTimeWindow("08:00-25:00")
+	assert.EqualError(t, err, `invalid time window "08:00-25:00": invalid time "25:00"`)
+}
+
+func TestTimeWindow_Remaining(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tw := TimeWindow{Start: 8 * time.Hour, End: 18 * time.Hour}
+	assert.True(t, tw.In(at(8, 0)))
+	assert.False(t, tw.In(at(18, 0)))
+	assert.Equal(t, 2*time.Hour, tw.Remaining(at(16, 0)))
+	assert.Equal(t, time.Duration(0), tw.Remaining(at(19, 0)))
+
+	// cross midnight
+	tw = TimeWindow{Start: 22 * time.Hour, End: 6 * time.Hour}
+	assert.True(t, tw.In(at(23, 0)))
+	assert.True(t, tw.In(at(1, 0)))
+	assert.False(t, tw.In(at(12, 0)))
+	assert.Equal(t, 7*time.Hour, tw.Remaining(at(23, 0)))
+	assert.Equal(t, 5*time.Hour, tw.Remaining(at(1, 0)))
+}
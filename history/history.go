@@ -0,0 +1,220 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/result"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// dbPath the history database, it's opened for each operation,
+	// so `vtsbackup history` is able to read it while the agent is running.
+	dbPath = filepath.Join(config.VtsBackupDir, "history.db")
+
+	openTimeout = 5 * time.Second
+)
+
+// Record of a model run
+type Record struct {
+	ID         string    `json:"id"`
+	Model      string    `json:"model"`
+	Trigger    string    `json:"trigger,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Duration in seconds
+	Duration     float64              `json:"duration"`
+	Stages       []StageRecord        `json:"stages,omitempty"`
+	ArchiveSize  int64                `json:"archive_size"`
+	SkippedFiles []result.SkippedFile `json:"skipped_files,omitempty"`
+	Storages     []StorageRecord      `json:"storages,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// StageRecord the timing of a pipeline stage
+type StageRecord struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+}
+
+// StorageRecord the outcome of a storage
+type StorageRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// NewRecord convert the run result to the record
+func NewRecord(rr *result.RunResult) Record {
+	record := Record{
+		ID:           rr.ID,
+		Model:        rr.Model,
+		Trigger:      rr.Trigger,
+		Attempt:      rr.Attempt,
+		Status:       rr.Status,
+		StartedAt:    rr.StartedAt,
+		FinishedAt:   rr.FinishedAt,
+		Duration:     rr.Duration.Seconds(),
+		ArchiveSize:  rr.ArchiveSize,
+		SkippedFiles: rr.SkippedFiles,
+		Error:        rr.Error,
+	}
+
+	for _, stage := range rr.Stages {
+		record.Stages = append(record.Stages, StageRecord{
+			Name:      stage.Name,
+			StartedAt: stage.StartedAt,
+			Duration:  stage.Duration.Seconds(),
+		})
+	}
+
+	for _, storage := range rr.Storages {
+		record.Storages = append(record.Storages, StorageRecord{
+			Name:     storage.Name,
+			Type:     storage.Type,
+			Duration: storage.Duration.Seconds(),
+			Error:    storage.Error,
+		})
+	}
+
+	return record
+}
+
+func open() (*bolt.DB, error) {
+	if err := helper.MkdirP(filepath.Dir(dbPath)); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open history database %s: %v", dbPath, err)
+	}
+
+	return db, nil
+}
+
+// Save the record and remove the oldest records of the model beyond `history.keep`
+func Save(record Record) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(record.Model))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put(itob(seq), data); err != nil {
+			return err
+		}
+
+		keep := config.History.Keep
+		if keep <= 0 {
+			return nil
+		}
+
+		// Keys are in insert order, remove from the oldest one
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		for i := 0; i < len(keys)-keep; i++ {
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// List the records newest first, all models when model is empty, all records when limit is 0
+func List(model string, limit int) ([]Record, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	records := []Record{}
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			if len(model) > 0 && string(name) != model {
+				return nil
+			}
+
+			c := bucket.Cursor()
+			count := 0
+			for k, v := c.Last(); k != nil && (limit <= 0 || count < limit); k, v = c.Prev() {
+				var record Record
+				if err := json.Unmarshal(v, &record); err != nil {
+					return fmt.Errorf("invalid history record %s/%d: %v", name, binary.BigEndian.Uint64(k), err)
+				}
+				records = append(records, record)
+				count++
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].StartedAt.After(records[j].StartedAt)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	return records, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,116 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package history
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTest(t *testing.T) {
+	t.Helper()
+
+	dbPath = filepath.Join(t.TempDir(), "history.db")
+	config.History = config.HistoryConfig{Keep: 1000}
+}
+
+func TestNewRecord(t *testing.T) {
+	rr := result.New("abc", "foo", "cli")
+	rr.Attempt = 2
+	rr.StartStage("compress")
+	rr.StartStage("storage")
+	rr.ArchiveSize = 1024
+	rr.AddSkippedFile("/etc/shadow", "Cannot open: Permission denied")
+	rr.AddStorage("s3", "s3", time.Second, nil)
+	rr.AddStorage("ftp", "ftp", 2*time.Second, errors.New("connection refused"))
+	rr.Finish(errors.New("Storage errors: [connection refused]"), false)
+
+	record := NewRecord(rr)
+	assert.Equal(t, "abc", record.ID)
+	assert.Equal(t, "foo", record.Model)
+	assert.Equal(t, "cli", record.Trigger)
+	assert.Equal(t, 2, record.Attempt)
+	assert.Equal(t, "failed", record.Status)
+	assert.Equal(t, "Storage errors: [connection refused]", record.Error)
+	assert.Equal(t, int64(1024), record.ArchiveSize)
+	assert.Equal(t, rr.Duration.Seconds(), record.Duration)
+	assert.Len(t, record.Stages, 2)
+	assert.Equal(t, "compress", record.Stages[0].Name)
+	assert.Equal(t, rr.SkippedFiles, record.SkippedFiles)
+	assert.Equal(t, []StorageRecord{
+		{Name: "s3", Type: "s3", Duration: 1},
+		{Name: "ftp", Type: "ftp", Duration: 2, Error: "connection refused"},
+	}, record.Storages)
+}
+
+func TestSaveAndList(t *testing.T) {
+	setupTest(t)
+
+	records, err := List("", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		for _, model := range []string{"foo", "bar"} {
+			record := Record{
+				ID:        fmt.Sprintf("%s-%d", model, i),
+				Model:     model,
+				Status:    "succeeded",
+				StartedAt: start.Add(time.Duration(i) * time.Minute),
+			}
+			assert.NoError(t, Save(record))
+		}
+	}
+
+	records, err = List("foo", 0)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "foo-2", records[0].ID)
+	assert.Equal(t, "foo-0", records[2].ID)
+
+	records, err = List("", 2)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "2", records[0].ID[len(records[0].ID)-1:])
+	assert.Equal(t, "2", records[1].ID[len(records[1].ID)-1:])
+
+	records, err = List("baz", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestSaveWithKeep(t *testing.T) {
+	setupTest(t)
+	config.History.Keep = 2
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, Save(Record{ID: fmt.Sprintf("%d", i), Model: "foo", StartedAt: time.Now()}))
+	}
+
+	records, err := List("foo", 0)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "4", records[0].ID)
+	assert.Equal(t, "3", records[1].ID)
+}
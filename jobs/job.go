@@ -0,0 +1,202 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of the job
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Pipeline stages of the model
+const (
+	StageArchive  = "archive"
+	StageCompress = "compress"
+	StageEncrypt  = "encrypt"
+	StageSplit    = "split"
+	StageStorage  = "storage"
+)
+
+// Triggers of the job
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerCLI      = "cli"
+	TriggerCatchUp  = "catch_up"
+)
+
+// Status of the job
+type Status struct {
+	ID             string     `json:"id"`
+	Model          string     `json:"model"`
+	Trigger        string     `json:"trigger,omitempty"`
+	State          State      `json:"state"`
+	Stage          string     `json:"stage,omitempty"`
+	BytesProcessed int64      `json:"bytes_processed"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// Job a run of the model
+type Job struct {
+	mu     sync.Mutex
+	status Status
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type jobContextKey struct{}
+type triggerContextKey struct{}
+
+func newJob(model, trigger string) *Job {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return &Job{
+		status: Status{
+			ID:        hex.EncodeToString(id),
+			Model:     model,
+			Trigger:   trigger,
+			State:     StateQueued,
+			CreatedAt: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// FromContext return the job of the context, nil if the context is not in a job
+func FromContext(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobContextKey{}).(*Job)
+	return job
+}
+
+// WithTrigger return a context with the trigger source of the jobs started by it
+func WithTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, triggerContextKey{}, trigger)
+}
+
+// TriggerFromContext return the trigger source of the context
+func TriggerFromContext(ctx context.Context) string {
+	trigger, _ := ctx.Value(triggerContextKey{}).(string)
+	return trigger
+}
+
+// SetStage update the current pipeline stage of the job in the context
+func SetStage(ctx context.Context, stage string) {
+	FromContext(ctx).SetStage(stage)
+}
+
+// ID of the job
+func (j *Job) ID() string {
+	return j.status.ID
+}
+
+// Status return a copy of the job status
+func (j *Job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+// Done is closed when the job is finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel the job, it's a no-op when the job is finished
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// SetStage update the current pipeline stage
+func (j *Job) SetStage(stage string) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Stage = stage
+}
+
+// AddBytes add the processed bytes
+func (j *Job) AddBytes(n int64) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.BytesProcessed += n
+}
+
+func (j *Job) isFinished() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *Job) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.status.State = StateRunning
+	j.status.StartedAt = &now
+}
+
+// finish the job, the job is cancelled when err is caused by the cancellation,
+// since the error may be formatted without wrapping, cancelled is checked by the job context.
+func (j *Job) finish(err error, cancelled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.status.FinishedAt = &now
+	switch {
+	case err == nil:
+		j.status.State = StateSucceeded
+	case cancelled || errors.Is(err, context.Canceled):
+		j.status.State = StateCancelled
+		j.status.Error = err.Error()
+	default:
+		j.status.State = StateFailed
+		j.status.Error = err.Error()
+	}
+
+	j.cancel()
+	close(j.done)
+}
@@ -0,0 +1,78 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hantbk/vtsbackup/helper"
+)
+
+// lockPollInterval the interval to retry the lock held by another process
+var lockPollInterval = time.Second
+
+// lockModel hold the lock file of the model to prevent other processes (e.g. `vtsbackup perform` and the daemon)
+// from running it at the same time. The lock is released by the kernel when the process exits.
+func lockModel(ctx context.Context, name string, wait bool) (unlock func(), err error) {
+	if err := helper.MkdirP(lockDir); err != nil {
+		return nil, err
+	}
+
+	lockPath := filepath.Join(lockDir, name+".lock")
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %s: %v", lockPath, err)
+	}
+
+	for {
+		err = helper.TryLockFile(f)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, helper.ErrLocked) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %v", lockPath, err)
+		}
+
+		if !wait {
+			f.Close()
+			return nil, fmt.Errorf("model %s is %w in another process", name, ErrAlreadyRunning)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Record the pid for debugging
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+
+	return func() {
+		helper.UnlockFile(f)
+		f.Close()
+	}, nil
+}
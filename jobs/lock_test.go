@@ -0,0 +1,52 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build unix
+
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_lockFile(t *testing.T) {
+	m := setupTest(t)
+
+	// Hold the lock like another process
+	f, err := os.OpenFile(filepath.Join(lockDir, "foo.lock"), os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, helper.TryLockFile(f))
+
+	err = m.Run(context.Background(), config.ModelConfig{Name: "foo", Overlap: config.OverlapSkip}, func(ctx context.Context) error { return nil })
+	assert.EqualError(t, err, "model foo is already running in another process")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = m.Run(ctx, config.ModelConfig{Name: "foo", Overlap: config.OverlapQueue}, func(ctx context.Context) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, helper.UnlockFile(f))
+	err = m.Run(context.Background(), config.ModelConfig{Name: "foo", Overlap: config.OverlapQueue}, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+}
@@ -0,0 +1,324 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/logger"
+)
+
+var (
+	// ErrAlreadyRunning the model is running and the overlap policy is `skip`
+	ErrAlreadyRunning = errors.New("already running")
+	// ErrJobNotFound the job is not found or has been evicted
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished the job is finished and can't be cancelled
+	ErrJobFinished = errors.New("job is finished")
+)
+
+// maxFinishedJobs the number of finished jobs to keep in memory
+const maxFinishedJobs = 100
+
+var (
+	defaultManager = NewManager()
+
+	// lockDir the directory of the cross-process lock files
+	lockDir = filepath.Join(config.VtsBackupDir, "locks")
+)
+
+// Manager control the concurrency of the models and track the jobs:
+//
+//   - one run per model at a time, in this process by `slot` and across processes by a lock file
+//   - at most `max_concurrent_jobs` runs at a time, 0 is unlimited
+//   - the `overlap` policy of the model decides what to do when it is triggered while running
+type Manager struct {
+	mu    sync.Mutex
+	slots map[string]*slot
+	// jobs in created order
+	jobs []*Job
+
+	limit   int
+	workers chan struct{}
+}
+
+// slot of a model, the sem is held by the running job
+type slot struct {
+	sem     chan struct{}
+	mu      sync.Mutex
+	current *Job
+}
+
+func (s *slot) setCurrent(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = job
+}
+
+// NewManager create a job manager
+func NewManager() *Manager {
+	return &Manager{slots: map[string]*slot{}}
+}
+
+// Start perform the model in background with default manager
+func Start(ctx context.Context, model config.ModelConfig, fn func(ctx context.Context) error) (*Job, error) {
+	return defaultManager.Start(ctx, model, fn)
+}
+
+// Run perform the model with default manager
+func Run(ctx context.Context, model config.ModelConfig, fn func(ctx context.Context) error) error {
+	return defaultManager.Run(ctx, model, fn)
+}
+
+// IsRunning check the model is running with default manager
+func IsRunning(name string) bool {
+	return defaultManager.IsRunning(name)
+}
+
+// Jobs return the jobs of default manager
+func Jobs() []Status {
+	return defaultManager.Jobs()
+}
+
+// Get the job by id from default manager
+func Get(id string) *Job {
+	return defaultManager.Get(id)
+}
+
+// Cancel the job by id in default manager
+func Cancel(id string) (*Job, error) {
+	return defaultManager.Cancel(id)
+}
+
+func (m *Manager) slot(name string) *slot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.slots[name]
+	if !ok {
+		s = &slot{sem: make(chan struct{}, 1)}
+		m.slots[name] = s
+	}
+
+	return s
+}
+
+// workerPool return the worker pool for current `max_concurrent_jobs`, nil is unlimited.
+// The pool is recreated when the config is changed, the running jobs release to the pool they acquired from.
+func (m *Manager) workerPool() chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.limit != config.MaxConcurrentJobs {
+		m.limit = config.MaxConcurrentJobs
+		m.workers = nil
+		if m.limit > 0 {
+			m.workers = make(chan struct{}, m.limit)
+		}
+	}
+
+	return m.workers
+}
+
+// IsRunning check the model is running in this process
+func (m *Manager) IsRunning(name string) bool {
+	return len(m.slot(name).sem) > 0
+}
+
+// Jobs return the status of the jobs, newest first
+func (m *Manager) Jobs() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		statuses = append(statuses, m.jobs[i].Status())
+	}
+
+	return statuses
+}
+
+// Get the job by id, nil if not found
+func (m *Manager) Get(id string) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.ID() == id {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// Cancel the job by id
+func (m *Manager) Cancel(id string) (*Job, error) {
+	job := m.Get(id)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if job.isFinished() {
+		return job, ErrJobFinished
+	}
+
+	job.Cancel()
+	return job, nil
+}
+
+// register the job, and evict the oldest finished jobs
+func (m *Manager) register(job *Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs = append(m.jobs, job)
+
+	finished := 0
+	for _, j := range m.jobs {
+		if j.isFinished() {
+			finished++
+		}
+	}
+
+	jobs := m.jobs[:0]
+	for _, j := range m.jobs {
+		if finished > maxFinishedJobs && j.isFinished() {
+			finished--
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	m.jobs = jobs
+}
+
+// admit create a job for the model, the error is ErrAlreadyRunning when the model is running with `skip` policy
+func (m *Manager) admit(ctx context.Context, model config.ModelConfig) (*Job, context.Context, bool, error) {
+	s := m.slot(model.Name)
+
+	job := newJob(model.Name, TriggerFromContext(ctx))
+	ctx, job.cancel = context.WithCancel(context.WithValue(ctx, jobContextKey{}, job))
+
+	acquired := false
+	select {
+	case s.sem <- struct{}{}:
+		acquired = true
+		s.setCurrent(job)
+	default:
+		if model.Overlap == config.OverlapSkip {
+			job.cancel()
+			return nil, nil, false, fmt.Errorf("model %s is %w", model.Name, ErrAlreadyRunning)
+		}
+	}
+
+	m.register(job)
+
+	return job, ctx, acquired, nil
+}
+
+// Start call fn in background when the model is able to run.
+// The ctx passed to fn is cancelled when the job is cancelled or a newer trigger has `cancel_previous` policy.
+func (m *Manager) Start(ctx context.Context, model config.ModelConfig, fn func(ctx context.Context) error) (*Job, error) {
+	job, ctx, acquired, err := m.admit(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	go m.execute(ctx, job, model, acquired, fn)
+
+	return job, nil
+}
+
+// Run call fn when the model is able to run, it blocks until fn returns.
+func (m *Manager) Run(ctx context.Context, model config.ModelConfig, fn func(ctx context.Context) error) error {
+	job, ctx, acquired, err := m.admit(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	return m.execute(ctx, job, model, acquired, fn)
+}
+
+func (m *Manager) execute(ctx context.Context, job *Job, model config.ModelConfig, acquired bool, fn func(ctx context.Context) error) (err error) {
+	logger := logger.Tag(fmt.Sprintf("Jobs: %s", model.Name))
+
+	defer func() {
+		job.finish(err, errors.Is(ctx.Err(), context.Canceled))
+	}()
+
+	s := m.slot(model.Name)
+	if !acquired {
+		if model.Overlap == config.OverlapCancelPrevious {
+			logger.Warn("Cancel the running one")
+			s.mu.Lock()
+			if s.current != nil {
+				s.current.Cancel()
+			}
+			s.mu.Unlock()
+		} else {
+			logger.Info("Already running, waiting in queue...")
+		}
+
+		select {
+		case s.sem <- struct{}{}:
+			s.setCurrent(job)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() { <-s.sem }()
+
+	if workers := m.workerPool(); workers != nil {
+		select {
+		case workers <- struct{}{}:
+		default:
+			logger.Infof("Reached max_concurrent_jobs %d, waiting...", cap(workers))
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer func() { <-workers }()
+	}
+
+	unlock, err := lockModel(ctx, model.Name, model.Overlap != config.OverlapSkip)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	job.start()
+
+	// The run context is separated, so the job is failed instead of cancelled when max_runtime is exceeded
+	runCtx := ctx
+	if maxRuntime := model.Schedule.MaxRuntime; maxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeoutCause(ctx, maxRuntime, fmt.Errorf("max_runtime %s exceeded: %w", maxRuntime, context.DeadlineExceeded))
+		defer cancel()
+	}
+
+	err = fn(runCtx)
+	if err != nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = context.Cause(runCtx)
+	}
+
+	return err
+}
@@ -0,0 +1,254 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTest(t *testing.T) *Manager {
+	t.Helper()
+
+	lockDir = t.TempDir()
+	lockPollInterval = 10 * time.Millisecond
+
+	return NewManager()
+}
+
+// startBlocking run the model in background until the returned channel is closed
+func startBlocking(m *Manager, model config.ModelConfig) (started chan struct{}, release chan struct{}, result chan error) {
+	started = make(chan struct{})
+	release = make(chan struct{})
+	result = make(chan error, 1)
+
+	go func() {
+		result <- m.Run(context.Background(), model, func(ctx context.Context) error {
+			close(started)
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	<-started
+
+	return
+}
+
+func TestManager_skip(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo", Overlap: config.OverlapSkip}
+
+	_, release, result := startBlocking(m, model)
+	assert.True(t, m.IsRunning("foo"))
+	assert.False(t, m.IsRunning("bar"))
+
+	err := m.Run(context.Background(), model, func(ctx context.Context) error {
+		t.Fatal("should be skipped")
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrAlreadyRunning))
+	assert.EqualError(t, err, "model foo is already running")
+
+	// Other models are not blocked
+	err = m.Run(context.Background(), config.ModelConfig{Name: "bar"}, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+
+	close(release)
+	assert.NoError(t, <-result)
+	assert.False(t, m.IsRunning("foo"))
+}
+
+func TestManager_queue(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo", Overlap: config.OverlapQueue}
+
+	_, release, result := startBlocking(m, model)
+
+	var ran atomic.Bool
+	done := make(chan error)
+	go func() {
+		done <- m.Run(context.Background(), model, func(ctx context.Context) error {
+			ran.Store(true)
+			return nil
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, ran.Load())
+
+	close(release)
+	assert.NoError(t, <-result)
+	assert.NoError(t, <-done)
+	assert.True(t, ran.Load())
+}
+
+func TestManager_cancelPrevious(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo", Overlap: config.OverlapCancelPrevious}
+
+	_, _, result := startBlocking(m, model)
+
+	err := m.Run(context.Background(), model, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	assert.ErrorIs(t, <-result, context.Canceled)
+}
+
+func TestManager_maxConcurrentJobs(t *testing.T) {
+	m := setupTest(t)
+
+	config.MaxConcurrentJobs = 2
+	defer func() { config.MaxConcurrentJobs = 0 }()
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := m.Run(context.Background(), config.ModelConfig{Name: name}, func(ctx context.Context) error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					old := atomic.LoadInt32(&maxRunning)
+					if n <= old || atomic.CompareAndSwapInt32(&maxRunning, old, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			assert.NoError(t, err)
+		}(name)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), maxRunning)
+}
+
+func TestManager_jobs(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo"}
+
+	release := make(chan struct{})
+	job, err := m.Start(context.Background(), model, func(ctx context.Context) error {
+		SetStage(ctx, StageStorage)
+		FromContext(ctx).AddBytes(1024)
+		<-release
+		return errors.New("upload failed")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, job, m.Get(job.ID()))
+	assert.Nil(t, m.Get("bar"))
+
+	assert.Eventually(t, func() bool {
+		return job.Status().Stage == StageStorage
+	}, time.Second, 5*time.Millisecond)
+
+	status := job.Status()
+	assert.Equal(t, StateRunning, status.State)
+	assert.Equal(t, "foo", status.Model)
+	assert.Equal(t, int64(1024), status.BytesProcessed)
+	assert.NotNil(t, status.StartedAt)
+	assert.Nil(t, status.FinishedAt)
+
+	close(release)
+	<-job.Done()
+
+	status = job.Status()
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, "upload failed", status.Error)
+	assert.NotNil(t, status.FinishedAt)
+
+	err = m.Run(context.Background(), model, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+
+	statuses := m.Jobs()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, StateSucceeded, statuses[0].State)
+	assert.Equal(t, job.ID(), statuses[1].ID)
+
+	_, err = m.Cancel(job.ID())
+	assert.Equal(t, ErrJobFinished, err)
+	_, err = m.Cancel("bar")
+	assert.Equal(t, ErrJobNotFound, err)
+}
+
+func TestManager_cancel(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo"}
+
+	running, err := m.Start(context.Background(), model, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+
+	queued, err := m.Start(context.Background(), model, func(ctx context.Context) error {
+		t.Fatal("should be cancelled before running")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StateQueued, queued.Status().State)
+
+	_, err = m.Cancel(queued.ID())
+	assert.NoError(t, err)
+	<-queued.Done()
+	assert.Equal(t, StateCancelled, queued.Status().State)
+	assert.Nil(t, queued.Status().StartedAt)
+
+	_, err = m.Cancel(running.ID())
+	assert.NoError(t, err)
+	<-running.Done()
+	assert.Equal(t, StateCancelled, running.Status().State)
+	assert.Equal(t, "context canceled", running.Status().Error)
+}
+
+func TestManager_maxRuntime(t *testing.T) {
+	m := setupTest(t)
+	model := config.ModelConfig{Name: "foo", Schedule: config.ScheduleConfig{MaxRuntime: 20 * time.Millisecond}}
+
+	job, err := m.Start(context.Background(), model, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+	<-job.Done()
+
+	status := job.Status()
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, "max_runtime 20ms exceeded: context deadline exceeded", status.Error)
+}
+
+func TestManager_evictFinishedJobs(t *testing.T) {
+	m := setupTest(t)
+
+	for i := 0; i < maxFinishedJobs+10; i++ {
+		assert.NoError(t, m.Run(context.Background(), config.ModelConfig{Name: "foo"}, func(ctx context.Context) error { return nil }))
+	}
+
+	assert.Len(t, m.Jobs(), maxFinishedJobs+1)
+}
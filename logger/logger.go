@@ -45,7 +45,12 @@ type writer struct {
 }
 
 func (w writer) Write(b []byte) (n int, err error) {
-	return w.Writer.Write(append([]byte(time.Now().Format(w.timeFormat)+" "), b...))
+	// Return the length of b, the io.MultiWriter treats the longer write with time as a short write
+	if _, err := w.Writer.Write(append([]byte(time.Now().Format(w.timeFormat)+" "), b...)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
 }
 
 func init() {
@@ -0,0 +1,129 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// runLogs the log lines of the running runs by the run ID. With the concurrent runs, the log of the process
+// has the lines of the other runs, so the healthcheck and notifiers only send the lines of the run.
+var (
+	runLogs   = map[string]*ringBuffer{}
+	runLogsMu sync.Mutex
+)
+
+type runLogKey struct{}
+
+// WithRun capture the lines written by the loggers of the returned context (see TagContext) as the log of the run,
+// until end is called
+func WithRun(ctx context.Context, id string) (runCtx context.Context, end func()) {
+	buf := newRingBuffer(1000)
+
+	runLogsMu.Lock()
+	runLogs[id] = buf
+	runLogsMu.Unlock()
+
+	return context.WithValue(ctx, runLogKey{}, buf), func() {
+		runLogsMu.Lock()
+		defer runLogsMu.Unlock()
+
+		if runLogs[id] == buf {
+			delete(runLogs, id)
+		}
+	}
+}
+
+// RunTail return the last n log lines of the run without colors, nil when the run is not captured or ended
+func RunTail(id string, n int) []string {
+	runLogsMu.Lock()
+	buf, ok := runLogs[id]
+	runLogsMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return buf.tail(n)
+}
+
+// TagContext return the logger with the tag like Tag, the lines are also captured by the run of ctx
+func TagContext(ctx context.Context, tag string) Logger {
+	buf, ok := ctx.Value(runLogKey{}).(*ringBuffer)
+	if !ok {
+		return Tag(tag)
+	}
+
+	// The shared logger adds the time by the writer when there is no flag
+	var runWriter io.Writer = buf
+	if _myLog.Flags() == 0 {
+		runWriter = &writer{buf, TimeFormat}
+	}
+
+	myLog := log.New(io.MultiWriter(_myLog.Writer(), runWriter), color.CyanString(fmt.Sprintf("[%s] ", tag)), _myLog.Flags())
+	return Logger{_logFlag, myLog}
+}
+
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ringBuffer keep the last size lines written to it
+type ringBuffer struct {
+	mu      sync.Mutex
+	size    int
+	lines   []string
+	partial string
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (r *ringBuffer) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := r.partial + string(b)
+	lines := strings.Split(text, "\n")
+	// The last one is not terminated yet
+	r.partial = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		r.lines = append(r.lines, ansiRegexp.ReplaceAllString(line, ""))
+	}
+	if len(r.lines) > r.size {
+		r.lines = append([]string{}, r.lines[len(r.lines)-r.size:]...)
+	}
+
+	return len(b), nil
+}
+
+func (r *ringBuffer) tail(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n <= 0 || n > len(r.lines) {
+		n = len(r.lines)
+	}
+
+	return append([]string{}, r.lines[len(r.lines)-n:]...)
+}
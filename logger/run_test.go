@@ -0,0 +1,71 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTail(t *testing.T) {
+	ctx1, end1 := WithRun(context.Background(), "run1")
+	ctx2, end2 := WithRun(context.Background(), "run2")
+
+	TagContext(ctx1, "Model: foo").Info("upload foo")
+	TagContext(ctx2, "Model: bar").Error("upload bar failed")
+	Tag("Scheduler").Info("not in any run")
+
+	lines := RunTail("run1", 10)
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "[Model: foo]")
+	assert.Contains(t, lines[0], "upload foo")
+
+	lines = RunTail("run2", 10)
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "upload bar failed")
+
+	end1()
+	assert.Nil(t, RunTail("run1", 10))
+	assert.Len(t, RunTail("run2", 10), 1)
+	end2()
+	assert.Nil(t, RunTail("run2", 10))
+
+	// Without run
+	TagContext(context.Background(), "Test").Info("foo")
+	assert.Nil(t, RunTail("", 10))
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(3)
+	assert.Empty(t, r.tail(10))
+
+	r.Write([]byte("a\nb\n"))
+	r.Write([]byte("c"))
+	assert.Equal(t, []string{"a", "b"}, r.tail(10))
+
+	r.Write([]byte("d\ne\n"))
+	assert.Equal(t, []string{"b", "cd", "e"}, r.tail(0))
+	assert.Equal(t, []string{"e"}, r.tail(1))
+
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+	r.Write([]byte(color.RedString("failed") + "\n"))
+	assert.Equal(t, []string{"failed"}, r.tail(1))
+}
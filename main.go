@@ -16,6 +16,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"fmt"
@@ -33,8 +34,11 @@ import (
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/decompressor"
 	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/history"
+	"github.com/hantbk/vtsbackup/jobs"
 	"github.com/hantbk/vtsbackup/logger"
 	"github.com/hantbk/vtsbackup/model"
+	"github.com/hantbk/vtsbackup/notifier"
 	"github.com/hantbk/vtsbackup/scheduler"
 	"github.com/hantbk/vtsbackup/storage"
 	"github.com/hantbk/vtsbackup/web"
@@ -253,6 +257,77 @@ func main() {
 				return listModel()
 			},
 		},
+		{
+			Name:  "pause",
+			Usage: "Pause the scheduled runs of a model",
+			Flags: buildFlags([]cli.Flag{
+				&cli.StringFlag{
+					Name:     "model",
+					Aliases:  []string{"m"},
+					Usage:    "Model name to pause",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "Resume automatically at the time, e.g. 2h, \"2024-05-01 18:00\", default: until resumed",
+				},
+			}),
+			Action: func(ctx *cli.Context) error {
+				return pauseModel(ctx.String("model"), ctx.String("until"))
+			},
+		},
+		{
+			Name:  "resume",
+			Usage: "Resume the scheduled runs of a paused model",
+			Flags: buildFlags([]cli.Flag{
+				&cli.StringFlag{
+					Name:     "model",
+					Aliases:  []string{"m"},
+					Usage:    "Model name to resume",
+					Required: true,
+				},
+			}),
+			Action: func(ctx *cli.Context) error {
+				return resumeModel(ctx.String("model"))
+			},
+		},
+		{
+			Name:  "history",
+			Usage: "Show the run history of the models",
+			Flags: buildFlags([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "model",
+					Aliases: []string{"m"},
+					Usage:   "Model name to show history for",
+				},
+				&cli.IntFlag{
+					Name:    "limit",
+					Aliases: []string{"n"},
+					Usage:   "Number of runs to show",
+					Value:   20,
+				},
+			}),
+			Action: func(ctx *cli.Context) error {
+				return listHistory(ctx.String("model"), ctx.Int("limit"))
+			},
+		},
+		{
+			Name:  "notify-queue",
+			Usage: "Show the failed notifications waiting to be retried",
+			Flags: buildFlags([]cli.Flag{
+				&cli.BoolFlag{
+					Name:  "flush",
+					Usage: "Retry all the queued notifications now",
+				},
+				&cli.BoolFlag{
+					Name:  "purge",
+					Usage: "Remove all the queued notifications without sending",
+				},
+			}),
+			Action: func(ctx *cli.Context) error {
+				return notifyQueue(ctx.Bool("flush"), ctx.Bool("purge"))
+			},
+		},
 		{
 			Name:  "listB",
 			Usage: "List backup files for a specific model in S3",
@@ -425,7 +500,7 @@ func perform(modelNames []string) error {
 	}
 
 	for _, m := range models {
-		if err := m.Perform(); err != nil {
+		if err := jobs.Run(jobs.WithTrigger(context.Background(), jobs.TriggerCLI), m.Config, m.Run); err != nil {
 			logger.Tag(fmt.Sprintf("Model %s", m.Config.Name)).Error(err)
 		}
 	}
@@ -433,6 +508,48 @@ func perform(modelNames []string) error {
 	return nil
 }
 
+func pauseModel(name, until string) error {
+	if err := initApplication(); err != nil {
+		return err
+	}
+	if model.GetModelByName(name) == nil {
+		return fmt.Errorf("model %s not found in %s", name, viper.ConfigFileUsed())
+	}
+
+	untilTime, err := scheduler.ParseUntil(until, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := scheduler.Pause(name, untilTime); err != nil {
+		return err
+	}
+
+	if untilTime.IsZero() {
+		fmt.Printf("Model %s is paused until resumed.\n", name)
+	} else {
+		fmt.Printf("Model %s is paused until %s.\n", name, untilTime.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func resumeModel(name string) error {
+	if err := initApplication(); err != nil {
+		return err
+	}
+	if model.GetModelByName(name) == nil {
+		return fmt.Errorf("model %s not found in %s", name, viper.ConfigFileUsed())
+	}
+
+	if err := scheduler.Resume(name); err != nil {
+		return err
+	}
+	fmt.Printf("Model %s is resumed.\n", name)
+
+	return nil
+}
+
 func listBackupAgents() ([]int, error) {
 	cmd := exec.Command("ps", "aux")
 	output, err := cmd.Output()
@@ -531,6 +648,19 @@ func listModel() error {
 			}
 			if m.Config.Schedule.Enabled {
 				fmt.Printf("  Schedule: %s\n", m.Config.Schedule.String())
+				if state := scheduler.GetState(m.Config.Name); state.IsPaused(time.Now()) {
+					if state.PausedUntil.IsZero() {
+						fmt.Println("  Paused: until resumed")
+					} else {
+						fmt.Printf("  Paused: until %s\n", state.PausedUntil.Format(time.RFC3339))
+					}
+				}
+				if lastRun := scheduler.LastRun(m.Config.Name); !lastRun.IsZero() {
+					fmt.Printf("  Last run: %s\n", lastRun.Format(time.RFC3339))
+				}
+				if nextRun := scheduler.NextRun(m.Config); !nextRun.IsZero() {
+					fmt.Printf("  Next run: %s\n", nextRun.Format(time.RFC3339))
+				}
 			}
 			if m.Config.Archive != nil {
 				fmt.Println("  Archive:")
@@ -565,6 +695,8 @@ func listModel() error {
 					} else if storage.Type == "scp" {
 						fmt.Printf("      Host: %s\n", storage.Viper.GetString("host"))
 						fmt.Printf("      Path: %s\n", storage.Viper.GetString("path"))
+					} else if storage.Type == "rclone" {
+						fmt.Printf("      Remote: %s\n", storage.Viper.GetString("remote"))
 					}
 				}
 			}
@@ -574,6 +706,105 @@ func listModel() error {
 	return nil
 }
 
+func listHistory(modelName string, limit int) error {
+	err := initApplication()
+	if err != nil {
+		return err
+	}
+
+	if len(modelName) > 0 && model.GetModelByName(modelName) == nil {
+		return fmt.Errorf("model: %q not found", modelName)
+	}
+
+	records, err := history.List(modelName, limit)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %v", err)
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No run history found.")
+		return nil
+	}
+
+	for _, record := range records {
+		fmt.Printf("- %s %s %s (Trigger: %s, Duration: %s, Size: %s)\n",
+			record.StartedAt.Format(time.RFC3339),
+			record.Model,
+			record.Status,
+			record.Trigger,
+			time.Duration(record.Duration*float64(time.Second)).Round(time.Millisecond),
+			humanize.Bytes(uint64(record.ArchiveSize)),
+		)
+		if record.Attempt > 0 {
+			fmt.Printf("  Attempt: %d\n", record.Attempt)
+		}
+		for _, stage := range record.Stages {
+			fmt.Printf("  Stage %s: %s\n", stage.Name, time.Duration(stage.Duration*float64(time.Second)).Round(time.Millisecond))
+		}
+		for _, storage := range record.Storages {
+			if len(storage.Error) > 0 {
+				fmt.Printf("  Storage %s:%s failed: %s\n", storage.Name, storage.Type, storage.Error)
+			} else {
+				fmt.Printf("  Storage %s:%s succeeded\n", storage.Name, storage.Type)
+			}
+		}
+		if len(record.Error) > 0 {
+			fmt.Printf("  Error: %s\n", record.Error)
+		}
+	}
+
+	return nil
+}
+
+func notifyQueue(flush, purge bool) error {
+	err := initApplication()
+	if err != nil {
+		return err
+	}
+
+	if purge {
+		count, err := notifier.PurgeQueue()
+		if err != nil {
+			return fmt.Errorf("failed to purge notify queue: %v", err)
+		}
+		fmt.Printf("Removed %d queued notifications.\n", count)
+		return nil
+	}
+
+	if flush {
+		sent, err := notifier.RetryQueue(true)
+		if err != nil {
+			return fmt.Errorf("failed to flush notify queue: %v", err)
+		}
+		fmt.Printf("Sent %d queued notifications.\n", sent)
+	}
+
+	items, err := notifier.Queue()
+	if err != nil {
+		return fmt.Errorf("failed to load notify queue: %v", err)
+	}
+
+	if len(items) == 0 {
+		fmt.Println("No queued notifications.")
+		return nil
+	}
+
+	for _, n := range items {
+		fmt.Printf("- #%d %s -> %s: %s (Attempts: %d, Queued: %s, Next: %s)\n",
+			n.ID,
+			n.Model,
+			n.Notifier,
+			n.Title,
+			n.Attempts,
+			n.CreatedAt.Format(time.RFC3339),
+			n.NextAt.Format(time.RFC3339),
+		)
+		fmt.Printf("  Error: %s\n", n.LastError)
+	}
+
+	return nil
+}
+
 func listBackupFiles(modelName string) error {
 	err := initApplication()
 	if err != nil {
@@ -16,16 +16,23 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/hantbk/vtsbackup/archive"
 	"github.com/hantbk/vtsbackup/compressor"
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/encryptor"
+	"github.com/hantbk/vtsbackup/healthcheck"
 	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/history"
+	"github.com/hantbk/vtsbackup/jobs"
 	"github.com/hantbk/vtsbackup/logger"
 	"github.com/hantbk/vtsbackup/notifier"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/hantbk/vtsbackup/splitter"
 	"github.com/hantbk/vtsbackup/storage"
 	"github.com/spf13/viper"
@@ -34,23 +41,36 @@ import (
 // Model class
 type Model struct {
 	Config config.ModelConfig
+	// Attempt of the run when it's retried, starts from 1, 0 is not retried
+	Attempt int
+	// SkipFailureNotify skip the failure notification, e.g. the failed run will be retried
+	SkipFailureNotify bool
 }
 
-// Perform model
-func (m Model) Perform() (err error) {
-	logger := logger.Tag(fmt.Sprintf("Model: %s", m.Config.Name))
+// Perform model, the pipeline is stopped when ctx is cancelled.
+// The returned result is always non-nil, even if the run is failed.
+func (m Model) Perform(ctx context.Context) (rr *result.RunResult, err error) {
+	rr = m.newRunResult(ctx)
 
-	m.before()
+	// Capture the log of the run for the healthcheck and notifiers, it ends after they are sent
+	ctx, endLog := logger.WithRun(ctx, rr.ID)
+	defer endLog()
+
+	logger := logger.TagContext(ctx, fmt.Sprintf("Model: %s", m.Config.Name))
 
+	healthcheck.Start(m.Config)
+	notifier.Started(m.Config, rr)
 	defer func() {
-		if err != nil {
-			logger.Error(err)
-			notifier.Failure(m.Config, err.Error())
-		} else {
-			notifier.Success(m.Config)
+		// Report the cause, e.g. max_runtime exceeded, instead of the error of the interrupted stage
+		if err != nil && ctx.Err() != nil {
+			err = context.Cause(ctx)
 		}
+
+		m.finish(ctx, rr, err)
 	}()
 
+	m.before()
+
 	logger.Info("WorkDir:", m.Config.DumpPath)
 
 	defer func() {
@@ -62,34 +82,119 @@ func (m Model) Perform() (err error) {
 	}()
 
 	if m.Config.Archive != nil {
-		err = archive.Run(m.Config)
+		m.startStage(ctx, rr, jobs.StageArchive)
+		err = archive.Run(ctx, m.Config, rr)
 		if err != nil {
 			return
 		}
 	}
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	// It always to use compressor, default use tar, even not enable compress.
-	archivePath, err := compressor.Run(m.Config)
+	m.startStage(ctx, rr, jobs.StageCompress)
+	archivePath, err := compressor.Run(ctx, m.Config, rr)
 	if err != nil {
 		return
 	}
 
-	archivePath, err = encryptor.Run(archivePath, m.Config)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	m.startStage(ctx, rr, jobs.StageEncrypt)
+	archivePath, err = encryptor.Run(ctx, archivePath, m.Config, rr)
 	if err != nil {
 		return
 	}
 
-	archivePath, err = splitter.Run(archivePath, m.Config)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	m.startStage(ctx, rr, jobs.StageSplit)
+	archivePath, err = splitter.Run(ctx, archivePath, m.Config, rr)
 	if err != nil {
 		return
 	}
 
-	err = storage.Run(m.Config, archivePath)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	m.startStage(ctx, rr, jobs.StageStorage)
+	err = storage.Run(ctx, m.Config, archivePath, rr)
 	if err != nil {
 		return
 	}
 
-	return nil
+	return rr, nil
+}
+
+// Fail report the model as failed without performing, e.g. the upstream model is failed
+func (m Model) Fail(ctx context.Context, reason error) *result.RunResult {
+	rr := m.newRunResult(ctx)
+	m.finish(ctx, rr, reason)
+	return rr
+}
+
+// finish the run result, save it to history and notify
+func (m Model) finish(ctx context.Context, rr *result.RunResult, err error) {
+	logger := logger.TagContext(ctx, fmt.Sprintf("Model: %s", m.Config.Name))
+
+	rr.Finish(err, errors.Is(ctx.Err(), context.Canceled))
+	if err := history.Save(history.NewRecord(rr)); err != nil {
+		logger.Errorf("Failed to save history: %v", err)
+	}
+
+	if err != nil {
+		logger.Error(err)
+		if m.SkipFailureNotify {
+			logger.Info("Skip the failure notification, it will be retried")
+		} else {
+			healthcheck.Finish(m.Config, rr.ID, err)
+			notifier.Failure(m.Config, rr)
+		}
+	} else {
+		healthcheck.Finish(m.Config, rr.ID, nil)
+		notifier.Success(m.Config, rr)
+	}
+
+	notifier.Pruned(m.Config, rr)
+}
+
+// NotifyFailure notify the failure of the run skipped by SkipFailureNotify, e.g. the retry is dropped when the scheduler is stopped
+func (m Model) NotifyFailure(rr *result.RunResult, err error) {
+	healthcheck.Finish(m.Config, rr.ID, err)
+	notifier.Failure(m.Config, rr)
+}
+
+// Run perform the model and only return the error, it's the function of the job
+func (m Model) Run(ctx context.Context) error {
+	_, err := m.Perform(ctx)
+	return err
+}
+
+// newRunResult create the result of the run, it has the same ID with the job
+func (m Model) newRunResult(ctx context.Context) *result.RunResult {
+	id := fmt.Sprintf("%d", time.Now().UnixNano())
+	trigger := jobs.TriggerFromContext(ctx)
+	if job := jobs.FromContext(ctx); job != nil {
+		status := job.Status()
+		id, trigger = status.ID, status.Trigger
+	}
+
+	rr := result.New(id, m.Config.Name, trigger)
+	rr.Attempt = m.Attempt
+
+	return rr
+}
+
+func (m Model) startStage(ctx context.Context, rr *result.RunResult, stage string) {
+	jobs.SetStage(ctx, stage)
+	rr.StartStage(stage)
 }
 
 func (m Model) before() {
@@ -21,35 +21,55 @@ import (
 
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/spf13/viper"
 )
 
 type Base struct {
-	viper     *viper.Viper
-	Name      string
-	onSuccess bool
-	onFailure bool
+	viper *viper.Viper
+	Name  string
+	// events subscribed by the notifier
+	events map[string]bool
+	// event of the current notification
+	event string
+	// result of the run, the rich formatted notifiers build the fields from it
+	result *result.RunResult
+	// titleTemplate and bodyTemplate override the default title and message
+	titleTemplate string
+	bodyTemplate  string
+	// minInterval the minimum interval between the notifications of the same status
+	minInterval time.Duration
+	// onChange only notify when the status is changed, e.g. failed -> succeeded
+	onChange bool
+	// digest send a daily summary by the scheduler instead of the notification of each run
+	digest bool
 }
 
 type Notifier interface {
 	notify(title, message string) error
 }
 
-var (
-	notifyTypeSuccess = 1
-	notifyTypeFailure = 2
-)
-
-func newNotifier(name string, config config.SubConfig) (Notifier, *Base, error) {
+func newNotifier(name string, config config.SubConfig, rr *result.RunResult) (Notifier, *Base, error) {
 	base := &Base{
-		viper: config.Viper,
-		Name:  name,
+		viper:  config.Viper,
+		Name:   name,
+		result: rr,
+	}
+	if err := base.parseEvents(); err != nil {
+		return nil, nil, err
 	}
-	base.viper.SetDefault("on_success", true)
-	base.viper.SetDefault("on_failure", true)
 
-	base.onSuccess = base.viper.GetBool("on_success")
-	base.onFailure = base.viper.GetBool("on_failure")
+	base.titleTemplate = base.viper.GetString("title_template")
+	base.bodyTemplate = base.viper.GetString("body_template")
+	base.minInterval = base.viper.GetDuration("min_interval")
+	base.onChange = base.viper.GetBool("on_change")
+	base.digest = base.viper.GetBool("digest")
+
+	if incidentNotifiers[config.Type] {
+		if err := base.checkIncidentEvents(); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	switch config.Type {
 	case "mail":
@@ -59,47 +79,118 @@ func newNotifier(name string, config config.SubConfig) (Notifier, *Base, error)
 		return NewWebhook(base), base, nil
 	case "telegram":
 		return NewTelegram(base), base, nil
+	case "slack":
+		return NewSlack(base), base, nil
+	case "discord":
+		return NewDiscord(base), base, nil
+	case "teams":
+		return NewTeams(base), base, nil
+	case "ntfy":
+		return NewNtfy(base), base, nil
+	case "gotify":
+		return NewGotify(base), base, nil
+	case "pushover":
+		return NewPushover(base), base, nil
+	case "matrix":
+		return NewMatrix(base), base, nil
+	case "pagerduty":
+		return NewPagerDuty(base), base, nil
+	case "opsgenie":
+		return NewOpsgenie(base), base, nil
 	}
 
 	return nil, nil, fmt.Errorf("Notifier: %s is not supported", name)
 }
 
-func notify(model config.ModelConfig, title, message string, notifyType int) {
+// notify the message of the first event subscribed by each notifier, e.g. a succeeded run with warnings
+// is notified as `warning` to the notifiers subscribe it, and as `succeeded` to the others
+func notify(model config.ModelConfig, rr *result.RunResult, messages ...eventMessage) {
 	logger := logger.Tag("Notifier")
 
 	logger.Infof("Running %d Notifiers", len(model.Notifiers))
-	for name, config := range model.Notifiers {
-		notifier, base, err := newNotifier(name, config)
+	for name, subConfig := range model.Notifiers {
+		notifier, base, err := newNotifier(name, subConfig, rr)
 		if err != nil {
 			logger.Error(err)
 			continue
 		}
 
-		if notifyType == notifyTypeSuccess {
-			if base.onSuccess {
-				if err := notifier.notify(title, message); err != nil {
-					logger.Error(err)
+		msg, ok := base.subscribed(messages)
+		if !ok {
+			continue
+		}
+		base.event = msg.event
+
+		if base.digest && runEvents[msg.event] {
+			logger.Infof("Skip %s, it sends the digest", name)
+			continue
+		}
+
+		now := time.Now()
+		if runEvents[msg.event] {
+			if skip, reason := base.throttled(model.Name, rr, now); skip {
+				logger.Infof("Skip %s, %s", name, reason)
+				continue
+			}
+		}
+
+		data := newTemplateData(model, rr, msg.title, msg.message)
+		data.Event = msg.event
+		title, message := base.render(data)
+		if err := notifier.notify(title, message); err == nil {
+			if runEvents[msg.event] {
+				if err := base.markSent(model.Name, rr, now); err != nil {
+					logger.Errorf("Failed to save notify state: %v", err)
 				}
 			}
-		} else if notifyType == notifyTypeFailure {
-			if base.onFailure {
-				if err := notifier.notify(title, message); err != nil {
-					logger.Error(err)
+		} else {
+			logger.Errorf("Failed to send notification to %s: %v", name, err)
+
+			if config.NotifyQueue.Enabled {
+				if err := enqueue(model.Name, name, msg.event, title, message, rr, err); err != nil {
+					logger.Errorf("Failed to queue the notification: %v", err)
+				} else {
+					logger.Infof("Notification to %s is queued for retry", name)
 				}
 			}
 		}
 	}
 }
 
-func Success(model config.ModelConfig) {
-	title := fmt.Sprintf("[Backup] OK: Backup %s has successfully", model.Name)
-	message := fmt.Sprintf("Backup of %s completed successfully at %s", model.Name, time.Now().Local())
-	notify(model, title, message, notifyTypeSuccess)
+// Success notify the model is performed successfully, the message includes the statistics of the run.
+// It's notified as `warning` to the notifiers subscribe it when the run has warnings.
+func Success(model config.ModelConfig, rr *result.RunResult) {
+	title, message := successMessage(model, rr)
+	succeeded := eventMessage{EventSucceeded, title, message}
+
+	if len(rr.Warnings()) > 0 {
+		notify(model, rr, warningMessage(model, rr), succeeded)
+	} else {
+		notify(model, rr, succeeded)
+	}
 }
 
-func Failure(model config.ModelConfig, reason string) {
-	title := fmt.Sprintf("[Backup] Err: Backup %s has failed", model.Name)
-	message := fmt.Sprintf("Backup of %s failed at %s:\n\n%s", model.Name, time.Now().Local(), reason)
+// Failure notify the model is failed, the reason is the error of the run.
+// It's notified as `warning` to the notifiers only subscribe it when the run has warnings, e.g. one of the storages is failed.
+func Failure(model config.ModelConfig, rr *result.RunResult) {
+	title, message := failureMessage(model, rr)
+	failed := eventMessage{EventFailed, title, message}
+
+	if len(rr.Warnings()) > 0 {
+		notify(model, rr, failed, warningMessage(model, rr))
+	} else {
+		notify(model, rr, failed)
+	}
+}
+
+func successMessage(model config.ModelConfig, rr *result.RunResult) (title, message string) {
+	title = fmt.Sprintf("[Backup] OK: Backup %s has successfully", model.Name)
+	message = fmt.Sprintf("Backup of %s completed successfully at %s\n\n%s", model.Name, rr.FinishedAt.Local(), rr.Summary())
+	return
+}
 
-	notify(model, title, message, notifyTypeFailure)
+func failureMessage(model config.ModelConfig, rr *result.RunResult) (title, message string) {
+	title = fmt.Sprintf("[Backup] Err: Backup %s has failed", model.Name)
+	message = fmt.Sprintf("Backup of %s failed at %s:\n\n%s\n\n%s", model.Name, rr.FinishedAt.Local(), rr.Error, rr.Summary())
+	return
 }
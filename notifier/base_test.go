@@ -0,0 +1,49 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessages(t *testing.T) {
+	model := config.ModelConfig{Name: "foo"}
+
+	rr := result.New("abc", "foo", "cli")
+	rr.AddStorage("s3", "s3", time.Second, nil)
+	rr.Finish(nil, false)
+
+	title, message := successMessage(model, rr)
+	assert.Equal(t, "[Backup] OK: Backup foo has successfully", title)
+	assert.Contains(t, message, "Backup of foo completed successfully at ")
+	assert.Contains(t, message, "- s3 (s3): succeeded in 1s")
+
+	rr = result.New("abc", "foo", "cli")
+	rr.AddStorage("s3", "s3", time.Second, errors.New("access denied"))
+	rr.Finish(errors.New("upload failed"), false)
+
+	title, message = failureMessage(model, rr)
+	assert.Equal(t, "[Backup] Err: Backup foo has failed", title)
+	assert.Contains(t, message, "failed at ")
+	assert.Contains(t, message, ":\n\nupload failed\n\n")
+	assert.Contains(t, message, "- s3 (s3): failed, access denied")
+}
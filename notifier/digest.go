@@ -0,0 +1,207 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/history"
+	"github.com/hantbk/vtsbackup/logger"
+)
+
+// maxDigestRuns the number of runs listed in the digest, the rest are only counted
+const maxDigestRuns = 50
+
+// DigestGroup the models share the notifier in `digest` mode, their runs are summarized in one digest.
+// The notifiers of the models with the same name and config are the same notifier.
+type DigestGroup struct {
+	Notifier string
+	// At the time of the day to send, e.g. `09:00`
+	At     string
+	Models []config.ModelConfig
+}
+
+// Digests return the notifiers in `digest` mode of the models, grouped by the notifier
+func Digests(models []config.ModelConfig) []DigestGroup {
+	var groups []DigestGroup
+	index := map[string]int{}
+
+	for _, model := range models {
+		names := make([]string, 0, len(model.Notifiers))
+		for name := range model.Notifiers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			subConfig := model.Notifiers[name]
+			if subConfig.Viper == nil || !subConfig.Viper.GetBool("digest") {
+				continue
+			}
+
+			subConfig.Viper.SetDefault("digest_at", "09:00")
+			settings, _ := json.Marshal(subConfig.Viper.AllSettings())
+			key := name + "/" + string(settings)
+
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, DigestGroup{Notifier: name, At: subConfig.Viper.GetString("digest_at")})
+			}
+			groups[i].Models = append(groups[i].Models, model)
+		}
+	}
+
+	return groups
+}
+
+// digestRuns the runs of the model since the last digest
+type digestRuns struct {
+	model   config.ModelConfig
+	records []history.Record
+	since   time.Time
+}
+
+// Digest send the summary of the runs of the models since the last digest by the notifier, it's called by the scheduler
+func Digest(group DigestGroup) {
+	logger := logger.Tag(fmt.Sprintf("Notifier: %s", group.Notifier))
+
+	if len(group.Models) == 0 {
+		return
+	}
+
+	first := group.Models[0]
+	subConfig, ok := first.Notifiers[group.Notifier]
+	if !ok {
+		logger.Errorf("Notifier %s of %s is not found", group.Notifier, first.Name)
+		return
+	}
+
+	notifier, base, err := newNotifier(group.Notifier, subConfig, nil)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	now := time.Now()
+	var runs []digestRuns
+	var names []string
+	for _, model := range group.Models {
+		since := getNotifyState(model.Name, group.Notifier).LastDigestAt
+		if since.IsZero() {
+			since = now.Add(-24 * time.Hour)
+		}
+
+		records, err := history.List(model.Name, 0)
+		if err != nil {
+			logger.Errorf("Failed to load history of %s: %v", model.Name, err)
+			return
+		}
+
+		runs = append(runs, digestRuns{model: model, records: records, since: since})
+		names = append(names, model.Name)
+	}
+
+	title, message := digestMessage(runs)
+	title, message = base.render(newTemplateData(config.ModelConfig{Name: strings.Join(names, ", ")}, nil, title, message))
+
+	logger.Info("Sending digest...")
+	if err := notifier.notify(title, message); err != nil {
+		logger.Errorf("Failed to send digest: %v", err)
+		if config.NotifyQueue.Enabled {
+			if err := enqueue(first.Name, group.Notifier, "", title, message, nil, err); err != nil {
+				logger.Errorf("Failed to queue the digest: %v", err)
+			}
+		}
+	}
+
+	for _, model := range group.Models {
+		if err := updateNotifyState(model.Name, group.Notifier, func(state *notifyState) {
+			state.LastDigestAt = now
+		}); err != nil {
+			logger.Errorf("Failed to save notify state: %v", err)
+		}
+	}
+}
+
+// digestMessage summarize the runs of the models started after the last digest, the records are newest first
+func digestMessage(runs []digestRuns) (title, message string) {
+	total, failed := 0, 0
+	sections := make([]string, 0, len(runs))
+	for _, r := range runs {
+		section, count, failedCount := digestSection(r)
+		sections = append(sections, section)
+		total += count
+		failed += failedCount
+	}
+
+	if len(runs) == 1 {
+		title = fmt.Sprintf("[Backup] Digest: %s %d runs, %d failed", runs[0].model.Name, total, failed)
+	} else {
+		title = fmt.Sprintf("[Backup] Digest: %d models, %d runs, %d failed", len(runs), total, failed)
+	}
+	message = strings.Join(sections, "\n\n")
+
+	return
+}
+
+// digestSection summarize the runs of the model, return the number of the runs and the failed ones
+func digestSection(r digestRuns) (section string, count, failed int) {
+	var runs []history.Record
+	for _, record := range r.records {
+		if !record.StartedAt.After(r.since) {
+			continue
+		}
+
+		runs = append(runs, record)
+		if record.Status == "failed" {
+			failed++
+		}
+	}
+
+	since := r.since.Local().Format(time.RFC3339)
+	if len(runs) == 0 {
+		return fmt.Sprintf("No backup of %s has run since %s", r.model.Name, since), 0, 0
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Backups of %s since %s:\n", r.model.Name, since)
+	for i, record := range runs {
+		if i == maxDigestRuns {
+			fmt.Fprintf(&sb, "\n... and %d more", len(runs)-maxDigestRuns)
+			break
+		}
+
+		fmt.Fprintf(&sb, "\n- %s %s in %s, %s",
+			record.StartedAt.Local().Format(time.RFC3339),
+			record.Status,
+			time.Duration(record.Duration*float64(time.Second)).Round(time.Second),
+			humanize.Bytes(uint64(record.ArchiveSize)),
+		)
+		if len(record.Error) > 0 {
+			fmt.Fprintf(&sb, ": %s", record.Error)
+		}
+	}
+
+	return sb.String(), len(runs), failed
+}
@@ -0,0 +1,113 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/history"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigests(t *testing.T) {
+	newViper := func(url, at string) *viper.Viper {
+		v := viper.New()
+		v.Set("type", "slack")
+		v.Set("url", url)
+		v.Set("digest", true)
+		if len(at) > 0 {
+			v.Set("digest_at", at)
+		}
+		return v
+	}
+
+	foo := config.ModelConfig{
+		Name: "foo",
+		Notifiers: map[string]config.SubConfig{
+			"slack":    {Type: "slack", Viper: newViper("https://hooks.slack.com/ops", "")},
+			"mail":     {Type: "mail", Viper: newViper("", "18:30")},
+			"telegram": {Type: "telegram", Viper: viper.New()},
+		},
+	}
+	bar := config.ModelConfig{
+		Name: "bar",
+		Notifiers: map[string]config.SubConfig{
+			"slack": {Type: "slack", Viper: newViper("https://hooks.slack.com/ops", "")},
+		},
+	}
+	// The same name to another channel is another notifier
+	baz := config.ModelConfig{
+		Name: "baz",
+		Notifiers: map[string]config.SubConfig{
+			"slack": {Type: "slack", Viper: newViper("https://hooks.slack.com/dev", "")},
+		},
+	}
+
+	groups := Digests([]config.ModelConfig{foo, bar, baz})
+	assert.Len(t, groups, 3)
+
+	assert.Equal(t, "mail", groups[0].Notifier)
+	assert.Equal(t, "18:30", groups[0].At)
+	assert.Equal(t, []config.ModelConfig{foo}, groups[0].Models)
+
+	assert.Equal(t, "slack", groups[1].Notifier)
+	assert.Equal(t, "09:00", groups[1].At)
+	assert.Equal(t, []config.ModelConfig{foo, bar}, groups[1].Models)
+
+	assert.Equal(t, "slack", groups[2].Notifier)
+	assert.Equal(t, []config.ModelConfig{baz}, groups[2].Models)
+}
+
+func TestDigestMessage(t *testing.T) {
+	foo := config.ModelConfig{Name: "foo"}
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+
+	title, message := digestMessage([]digestRuns{{model: foo, since: since}})
+	assert.Equal(t, "[Backup] Digest: foo 0 runs, 0 failed", title)
+	assert.Equal(t, "No backup of foo has run since "+since.Format(time.RFC3339), message)
+
+	records := []history.Record{
+		{Status: "failed", StartedAt: since.Add(2 * time.Hour), Duration: 5, Error: "upload failed"},
+		{Status: "succeeded", StartedAt: since.Add(time.Hour), Duration: 90, ArchiveSize: 2 * 1000 * 1000},
+		{Status: "succeeded", StartedAt: since.Add(-time.Hour), Duration: 90},
+	}
+	fooSection := "Backups of foo since " + since.Format(time.RFC3339) + ":\n" +
+		"\n- " + since.Add(2*time.Hour).Format(time.RFC3339) + " failed in 5s, 0 B: upload failed" +
+		"\n- " + since.Add(time.Hour).Format(time.RFC3339) + " succeeded in 1m30s, 2.0 MB"
+	title, message = digestMessage([]digestRuns{{model: foo, records: records, since: since}})
+	assert.Equal(t, "[Backup] Digest: foo 2 runs, 1 failed", title)
+	assert.Equal(t, fooSection, message)
+
+	// All the models of the notifier in one digest
+	barSince := since.Add(90 * time.Minute)
+	barRecords := []history.Record{
+		{Status: "failed", StartedAt: since.Add(2 * time.Hour), Duration: 5, Error: "dump failed"},
+		{Status: "succeeded", StartedAt: since.Add(time.Hour), Duration: 90},
+	}
+	title, message = digestMessage([]digestRuns{
+		{model: foo, records: records, since: since},
+		{model: config.ModelConfig{Name: "bar"}, records: barRecords, since: barSince},
+		{model: config.ModelConfig{Name: "baz"}, since: since},
+	})
+	assert.Equal(t, "[Backup] Digest: 3 models, 3 runs, 2 failed", title)
+	assert.Equal(t, fooSection+"\n\n"+
+		"Backups of bar since "+barSince.Format(time.RFC3339)+":\n"+
+		"\n- "+since.Add(2*time.Hour).Format(time.RFC3339)+" failed in 5s, 0 B: dump failed"+"\n\n"+
+		"No backup of baz has run since "+since.Format(time.RFC3339), message)
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type discordPayload struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// NewDiscord send the message to Discord Webhook
+//
+// type: discord
+// url: https://discord.com/api/webhooks/123456/xxxxxxxx
+// username: Backup
+func NewDiscord(base *Base) *Webhook {
+	return &Webhook{
+		Base:        *base,
+		Service:     "Discord",
+		method:      "POST",
+		contentType: "application/json",
+		buildBody: func(title, message string) ([]byte, error) {
+			embed := discordEmbed{
+				Title:       title,
+				Description: base.description(message),
+				Color:       base.color(),
+				Timestamp:   finishedAt(base.result).UTC().Format(time.RFC3339),
+			}
+			for _, f := range resultFields(base.result) {
+				embed.Fields = append(embed.Fields, discordField{Name: f.Name, Value: f.Value, Inline: f.Short})
+			}
+
+			return json.Marshal(discordPayload{
+				Username: base.viper.GetString("username"),
+				Embeds:   []discordEmbed{embed},
+			})
+		},
+		checkResult: func(status int, body []byte) error {
+			// 204 No Content, or 200 with `?wait=true`
+			if status != 200 && status != 204 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Discord(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("username", "Backup")
+
+	s := NewDiscord(base)
+	assert.Equal(t, "Discord", s.Service)
+	assert.Equal(t, "POST", s.method)
+	assert.Equal(t, "application/json", s.contentType)
+
+	body, err := s.buildBody("This is title", "This is body:\n\naccess denied")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"username":"Backup","embeds":[{"title":"This is title","description":"This is body","color":13959680,`+
+		`"fields":[{"name":"Model","value":"foo","inline":true},{"name":"Status","value":"failed","inline":true},`+
+		`{"name":"Duration","value":"1m30s","inline":true},{"name":"Size","value":"2.0 MB","inline":true},`+
+		`{"name":"Storages","value":"s3 (s3): failed, access denied","inline":false},{"name":"Error","value":"access denied","inline":false}],`+
+		`"timestamp":"2024-05-01T00:01:30Z"}]}`, string(body))
+
+	assert.NoError(t, s.checkResult(204, nil))
+	assert.NoError(t, s.checkResult(200, []byte(`{"id":"1"}`)))
+
+	respBody := `{"message": "Unknown Webhook", "code": 10015}`
+	err = s.checkResult(404, []byte(respBody))
+	assert.EqualError(t, err, "status: 404, body: "+respBody)
+}
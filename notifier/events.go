@@ -0,0 +1,206 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/result"
+)
+
+// Events of the notification, the notifier subscribes them by `events`,
+// the default is `succeeded` and `failed` by `on_success` and `on_failure`
+const (
+	EventStarted   = "started"
+	EventSucceeded = "succeeded"
+	EventFailed    = "failed"
+	// EventWarning the run has warnings, e.g. the files are skipped.
+	// The run with some of the storages failed is failed, it's only notified as warning to the notifiers don't subscribe `failed`.
+	EventWarning = "warning"
+	// EventPruned the old backups are removed by `keep`
+	EventPruned             = "pruned"
+	EventConfigReloadFailed = "config_reload_failed"
+)
+
+var events = []string{
+	EventStarted,
+	EventSucceeded,
+	EventFailed,
+	EventWarning,
+	EventPruned,
+	EventConfigReloadFailed,
+}
+
+// reservedEvents are not sent yet, they're rejected until the backup verification and the restore drill are implemented
+var reservedEvents = map[string]bool{
+	"verify_failed": true,
+	"drill_failed":  true,
+}
+
+// runEvents the events of the run, they are throttled by `min_interval` and `on_change`
+var runEvents = map[string]bool{
+	EventSucceeded: true,
+	EventFailed:    true,
+	EventWarning:   true,
+}
+
+// incidentEvents the events of the notifiers follow the status of the run by an incident,
+// `failed` triggers it and `succeeded` resolves it
+var incidentEvents = map[string]bool{
+	EventSucceeded: true,
+	EventFailed:    true,
+}
+
+// incidentNotifiers the types of the notifiers only subscribe incidentEvents
+var incidentNotifiers = map[string]bool{
+	"pagerduty": true,
+	"opsgenie":  true,
+}
+
+// eventMessage the message of the event
+type eventMessage struct {
+	event   string
+	title   string
+	message string
+}
+
+func init() {
+	config.OnConfigReloadFail(ConfigReloadFailed)
+	config.OnNotifierLoad(checkEvents)
+}
+
+// checkEvents check the events of the notifier when the config is loaded, so the unknown, reserved
+// and the unsupported events of the incident notifiers fail the config instead of the notifications
+func checkEvents(subConfig config.SubConfig) error {
+	base := &Base{
+		viper:  subConfig.Viper,
+		Name:   subConfig.Name,
+		digest: subConfig.Viper.GetBool("digest"),
+	}
+	if err := base.parseEvents(); err != nil {
+		return err
+	}
+
+	if incidentNotifiers[subConfig.Type] {
+		return base.checkIncidentEvents()
+	}
+
+	return nil
+}
+
+// parseEvents parse the subscribed events of the notifier
+func (b *Base) parseEvents() error {
+	b.events = map[string]bool{}
+
+	if !b.viper.IsSet("events") {
+		b.viper.SetDefault("on_success", true)
+		b.viper.SetDefault("on_failure", true)
+		b.events[EventSucceeded] = b.viper.GetBool("on_success")
+		b.events[EventFailed] = b.viper.GetBool("on_failure")
+		return nil
+	}
+
+	for _, event := range b.viper.GetStringSlice("events") {
+		if reservedEvents[event] {
+			return fmt.Errorf("Notifier: %s has event %q, it's not supported yet", b.Name, event)
+		}
+
+		found := false
+		for _, e := range events {
+			found = found || e == event
+		}
+		if !found {
+			return fmt.Errorf("Notifier: %s has unknown event %q, must be one of %s", b.Name, event, strings.Join(events, ", "))
+		}
+
+		b.events[event] = true
+	}
+
+	return nil
+}
+
+// checkIncidentEvents check the notifier only subscribes incidentEvents,
+// e.g. `started` of PagerDuty would resolve the incident of the failed runs before
+func (b *Base) checkIncidentEvents() error {
+	for event, ok := range b.events {
+		if ok && !incidentEvents[event] {
+			return fmt.Errorf("Notifier: %s doesn't support event %q, must be succeeded or failed", b.Name, event)
+		}
+	}
+
+	if b.digest {
+		return fmt.Errorf("Notifier: %s doesn't support digest", b.Name)
+	}
+
+	return nil
+}
+
+// subscribed return the first message of the events subscribed by the notifier
+func (b *Base) subscribed(messages []eventMessage) (eventMessage, bool) {
+	for _, msg := range messages {
+		if b.events[msg.event] {
+			return msg, true
+		}
+	}
+
+	return eventMessage{}, false
+}
+
+// Started notify the model is started
+func Started(model config.ModelConfig, rr *result.RunResult) {
+	title := fmt.Sprintf("[Backup] Started: Backup %s", model.Name)
+	message := fmt.Sprintf("Backup of %s started at %s", model.Name, rr.StartedAt.Local())
+	if len(rr.Trigger) > 0 {
+		message += fmt.Sprintf(" by %s", rr.Trigger)
+	}
+
+	notify(model, rr, eventMessage{EventStarted, title, message})
+}
+
+// Pruned notify the old backups are removed by `keep`
+func Pruned(model config.ModelConfig, rr *result.RunResult) {
+	if len(rr.Pruned) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The old backups of %s are removed by keep:\n", model.Name)
+	for _, pruned := range rr.Pruned {
+		fmt.Fprintf(&sb, "\n- %s: %s", pruned.Storage, strings.Join(pruned.Keys, ", "))
+	}
+
+	notify(model, rr, eventMessage{EventPruned, fmt.Sprintf("[Backup] Pruned: Backup %s", model.Name), sb.String()})
+}
+
+// ConfigReloadFailed notify the changed config is failed to load, by the notifiers of the models before the reload
+func ConfigReloadFailed(models []config.ModelConfig, err error) {
+	title := "[Backup] Err: Config reload has failed"
+	message := fmt.Sprintf("Failed to reload the config, the changes are not applied:\n\n%v", err)
+
+	for _, model := range models {
+		notify(model, nil, eventMessage{EventConfigReloadFailed, title, message})
+	}
+}
+
+func warningMessage(model config.ModelConfig, rr *result.RunResult) eventMessage {
+	title := fmt.Sprintf("[Backup] Warn: Backup %s has warnings", model.Name)
+	message := fmt.Sprintf("Backup of %s %s at %s with warnings: %s\n\n%s",
+		model.Name, rr.Status, rr.FinishedAt.Local(), strings.Join(rr.Warnings(), ", "), rr.Summary())
+
+	return eventMessage{EventWarning, title, message}
+}
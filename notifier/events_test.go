@@ -0,0 +1,221 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEvents(t *testing.T) {
+	base := &Base{Name: "slack", viper: viper.New()}
+	assert.NoError(t, base.parseEvents())
+	assert.Equal(t, map[string]bool{EventSucceeded: true, EventFailed: true}, base.events)
+
+	base.viper.Set("on_success", false)
+	assert.NoError(t, base.parseEvents())
+	assert.Equal(t, map[string]bool{EventSucceeded: false, EventFailed: true}, base.events)
+
+	base.viper.Set("events", []string{"started", "warning", "config_reload_failed"})
+	assert.NoError(t, base.parseEvents())
+	assert.Equal(t, map[string]bool{EventStarted: true, EventWarning: true, EventConfigReloadFailed: true}, base.events)
+
+	msg, ok := base.subscribed([]eventMessage{{event: EventFailed}, {event: EventWarning, title: "warning"}})
+	assert.True(t, ok)
+	assert.Equal(t, "warning", msg.title)
+	_, ok = base.subscribed([]eventMessage{{event: EventSucceeded}})
+	assert.False(t, ok)
+
+	base.viper.Set("events", []string{"finished"})
+	assert.EqualError(t, base.parseEvents(), `Notifier: slack has unknown event "finished", must be one of `+
+		"started, succeeded, failed, warning, pruned, config_reload_failed")
+
+	// The reserved events are not sent yet
+	base.viper.Set("events", []string{"failed", "verify_failed"})
+	assert.EqualError(t, base.parseEvents(), `Notifier: slack has event "verify_failed", it's not supported yet`)
+	base.viper.Set("events", []string{"drill_failed"})
+	assert.EqualError(t, base.parseEvents(), `Notifier: slack has event "drill_failed", it's not supported yet`)
+}
+
+func TestCheckIncidentEvents(t *testing.T) {
+	for _, notifierType := range []string{"pagerduty", "opsgenie"} {
+		v := viper.New()
+		_, _, err := newNotifier(notifierType, config.SubConfig{Type: notifierType, Viper: v}, nil)
+		assert.NoError(t, err)
+
+		v.Set("events", []string{"failed", "succeeded"})
+		_, _, err = newNotifier(notifierType, config.SubConfig{Type: notifierType, Viper: v}, nil)
+		assert.NoError(t, err)
+
+		v.Set("events", []string{"failed", "started"})
+		_, _, err = newNotifier(notifierType, config.SubConfig{Type: notifierType, Viper: v}, nil)
+		assert.EqualError(t, err, fmt.Sprintf(`Notifier: %s doesn't support event "started", must be succeeded or failed`, notifierType))
+
+		v.Set("events", []string{"failed"})
+		v.Set("digest", true)
+		_, _, err = newNotifier(notifierType, config.SubConfig{Type: notifierType, Viper: v}, nil)
+		assert.EqualError(t, err, fmt.Sprintf("Notifier: %s doesn't support digest", notifierType))
+	}
+
+	// The other notifiers subscribe any event
+	v := viper.New()
+	v.Set("url", "http://localhost")
+	v.Set("events", []string{"started", "pruned"})
+	_, _, err := newNotifier("webhook", config.SubConfig{Type: "webhook", Viper: v}, nil)
+	assert.NoError(t, err)
+}
+
+func TestCheckEvents(t *testing.T) {
+	v := viper.New()
+	v.Set("events", []string{"failed", "finished"})
+	assert.EqualError(t, checkEvents(config.SubConfig{Name: "slack", Type: "slack", Viper: v}), `Notifier: slack has unknown event "finished", must be one of `+
+		"started, succeeded, failed, warning, pruned, config_reload_failed")
+
+	v.Set("events", []string{"verify_failed"})
+	assert.EqualError(t, checkEvents(config.SubConfig{Name: "slack", Type: "slack", Viper: v}), `Notifier: slack has event "verify_failed", it's not supported yet`)
+
+	v.Set("events", []string{"failed", "started"})
+	assert.NoError(t, checkEvents(config.SubConfig{Name: "slack", Type: "slack", Viper: v}))
+	assert.EqualError(t, checkEvents(config.SubConfig{Name: "pd", Type: "pagerduty", Viper: v}), `Notifier: pd doesn't support event "started", must be succeeded or failed`)
+
+	v.Set("events", []string{"failed"})
+	v.Set("digest", true)
+	assert.EqualError(t, checkEvents(config.SubConfig{Name: "pd", Type: "pagerduty", Viper: v}), "Notifier: pd doesn't support digest")
+}
+
+func TestColor(t *testing.T) {
+	base := &Base{result: newTestResult(nil)}
+	assert.Equal(t, colorSuccess, base.color())
+
+	base.event = EventWarning
+	assert.Equal(t, colorWarning, base.color())
+	base.event = EventStarted
+	assert.Equal(t, colorUnknown, base.color())
+	base.event = EventConfigReloadFailed
+	base.result = nil
+	assert.Equal(t, colorFailure, base.color())
+}
+
+func TestFailure(t *testing.T) {
+	base := &Base{viper: viper.New(), result: newTestResult(errors.New("boom"))}
+	assert.True(t, base.failure())
+	assert.Equal(t, 8, base.statusPriority(5, 8))
+
+	// The config reload has no run
+	base.event = EventConfigReloadFailed
+	base.result = nil
+	assert.True(t, base.failure())
+	assert.Equal(t, 8, base.statusPriority(5, 8))
+
+	// Pruned is not a failure by the status of the run
+	base.event = EventPruned
+	base.result = newTestResult(errors.New("boom"))
+	assert.False(t, base.failure())
+	assert.Equal(t, 5, base.statusPriority(5, 8))
+
+	base.event = EventWarning
+	assert.True(t, base.failure())
+	base.result = newTestResult(nil)
+	assert.False(t, base.failure())
+}
+
+func TestNotifyEvents(t *testing.T) {
+	queuePath = filepath.Join(t.TempDir(), "notify_queue.db")
+	notifyStatePath = filepath.Join(t.TempDir(), "notify_state.json")
+
+	var mu sync.Mutex
+	received := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload) //nolint:errcheck
+
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload.Title)
+	}))
+	defer server.Close()
+
+	newWebhook := func(path string, events ...string) config.SubConfig {
+		v := viper.New()
+		v.Set("url", server.URL+path)
+		if len(events) > 0 {
+			v.Set("events", events)
+		}
+		return config.SubConfig{Type: "webhook", Viper: v}
+	}
+
+	model := config.ModelConfig{
+		Name: "foo",
+		Notifiers: map[string]config.SubConfig{
+			"default":   newWebhook("/default"),
+			"warning":   newWebhook("/warning", "warning"),
+			"lifecycle": newWebhook("/lifecycle", "started", "failed", "warning", "pruned", "config_reload_failed"),
+		},
+	}
+
+	rr := newTestResult(nil)
+	rr.Trigger = "cli"
+	Started(model, rr)
+
+	rr.AddSkippedFile("/etc/shadow", "Cannot open: Permission denied")
+	rr.AddPruned("s3", []string{"foo-1.tar.gz", "foo-2.tar.gz"})
+	Success(model, rr)
+	Pruned(model, rr)
+
+	rr = newTestResult(errors.New("Storage errors: [access denied]"))
+	rr.AddStorage("ftp", "ftp", 0, nil)
+	Failure(model, rr)
+
+	ConfigReloadFailed([]config.ModelConfig{model}, errors.New("no model found"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"[Backup] OK: Backup foo has successfully",
+		"[Backup] Err: Backup foo has failed",
+	}, received["/default"])
+	assert.Equal(t, []string{
+		"[Backup] Warn: Backup foo has warnings",
+		"[Backup] Warn: Backup foo has warnings",
+	}, received["/warning"])
+	assert.Equal(t, []string{
+		"[Backup] Started: Backup foo",
+		"[Backup] Warn: Backup foo has warnings",
+		"[Backup] Pruned: Backup foo",
+		"[Backup] Err: Backup foo has failed",
+		"[Backup] Err: Config reload has failed",
+	}, received["/lifecycle"])
+}
+
+func TestEventMessages(t *testing.T) {
+	model := config.ModelConfig{Name: "foo"}
+	rr := newTestResult(nil)
+	rr.AddSkippedFile("/etc/shadow", "Cannot open: Permission denied")
+
+	msg := warningMessage(model, rr)
+	assert.Equal(t, EventWarning, msg.event)
+	assert.Contains(t, msg.message, "Backup of foo succeeded at "+rr.FinishedAt.Local().String()+" with warnings: 1 files skipped\n\n")
+}
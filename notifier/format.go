@@ -0,0 +1,202 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hantbk/vtsbackup/jobs"
+	"github.com/hantbk/vtsbackup/result"
+)
+
+// field of the rich formatted message
+type field struct {
+	Name  string
+	Value string
+	// Short the field is able to be displayed side by side
+	Short bool
+}
+
+// Colors of the status
+const (
+	colorSuccess = 0x2EB886
+	colorFailure = 0xD50200
+	colorWarning = 0xDAA038
+	colorUnknown = 0x808080
+)
+
+// statusColor return the color of the run status, or unknown when there is no result
+func statusColor(rr *result.RunResult) int {
+	if rr == nil {
+		return colorUnknown
+	}
+	if rr.Status == string(jobs.StateSucceeded) {
+		return colorSuccess
+	}
+
+	return colorFailure
+}
+
+// color of the notification by the event, or by the run status
+func (b *Base) color() int {
+	switch b.event {
+	case EventWarning:
+		return colorWarning
+	case EventStarted, EventPruned:
+		return colorUnknown
+	case EventFailed, EventConfigReloadFailed:
+		return colorFailure
+	}
+
+	return statusColor(b.result)
+}
+
+// isFailure check the run is finished but not succeeded, e.g. failed or cancelled
+func isFailure(rr *result.RunResult) bool {
+	return rr != nil && len(rr.Status) > 0 && rr.Status != string(jobs.StateSucceeded)
+}
+
+// failure check the notification is a failure by the event, e.g. `config_reload_failed` has no run,
+// or by the run status for the warning
+func (b *Base) failure() bool {
+	switch b.event {
+	case EventFailed, EventConfigReloadFailed:
+		return true
+	case EventSucceeded, EventStarted, EventPruned:
+		return false
+	}
+
+	return isFailure(b.result)
+}
+
+// statusPriority return the priority of the notification by the event or the run status, the defaults of the service
+// are overridden by `success_priority` and `failure_priority`, or `priority` for both
+func (b *Base) statusPriority(success, failure int) int {
+	if b.viper.IsSet("priority") {
+		return b.viper.GetInt("priority")
+	}
+
+	b.viper.SetDefault("success_priority", success)
+	b.viper.SetDefault("failure_priority", failure)
+	if b.failure() {
+		return b.viper.GetInt("failure_priority")
+	}
+
+	return b.viper.GetInt("success_priority")
+}
+
+// resultFields return the fields of the run: model, status, size, duration and storages
+func resultFields(rr *result.RunResult) (fields []field) {
+	if rr == nil {
+		return nil
+	}
+
+	fields = append(fields,
+		field{Name: "Model", Value: rr.Model, Short: true},
+		field{Name: "Status", Value: rr.Status, Short: true},
+		field{Name: "Duration", Value: rr.Duration.Round(time.Second).String(), Short: true},
+	)
+	if rr.ArchiveSize > 0 {
+		fields = append(fields, field{Name: "Size", Value: humanize.Bytes(uint64(rr.ArchiveSize)), Short: true})
+	}
+	if rr.Attempt > 0 {
+		fields = append(fields, field{Name: "Attempt", Value: fmt.Sprintf("%d", rr.Attempt), Short: true})
+	}
+
+	if len(rr.Storages) > 0 {
+		var lines []string
+		for _, storage := range rr.Storages {
+			if len(storage.Error) > 0 {
+				lines = append(lines, fmt.Sprintf("%s (%s): failed, %s", storage.Name, storage.Type, storage.Error))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s (%s): succeeded in %s", storage.Name, storage.Type, storage.Duration.Round(time.Second)))
+			}
+		}
+		fields = append(fields, field{Name: "Storages", Value: strings.Join(lines, "\n")})
+	}
+
+	if len(rr.SkippedFiles) > 0 {
+		fields = append(fields, field{Name: "Skipped files", Value: fmt.Sprintf("%d", len(rr.SkippedFiles)), Short: true})
+	}
+
+	if len(rr.Error) > 0 {
+		fields = append(fields, field{Name: "Error", Value: rr.Error})
+	}
+
+	return fields
+}
+
+// resultDetails return the fields of the run as the custom details of the incident
+func resultDetails(rr *result.RunResult) map[string]string {
+	details := map[string]string{}
+	for _, f := range resultFields(rr) {
+		details[f.Name] = f.Value
+	}
+	if rr != nil {
+		details["Run ID"] = rr.ID
+		details["Trigger"] = rr.Trigger
+	}
+
+	return details
+}
+
+// incidentTriggered return the incident is triggered by the failed run, or resolved by the succeeded run,
+// it's an error for the other events
+func (b *Base) incidentTriggered() (bool, error) {
+	switch b.event {
+	case EventFailed:
+		return true, nil
+	case EventSucceeded:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("event %q is not supported by %s notifier", b.event, b.Name)
+}
+
+// incidentKey the stable dedup key of the incident of the model, so the next success resolves it
+func (b *Base) incidentKey() (string, error) {
+	if key := b.viper.GetString("dedup_key"); len(key) > 0 {
+		return key, nil
+	}
+	if b.result == nil {
+		return "", fmt.Errorf("the run result is required for %s notifier", b.Name)
+	}
+
+	return "vtsbackup-" + b.result.Model, nil
+}
+
+// description return the text of the rich formatted message, the statistics of the default message are replaced by the fields.
+// The message of `body_template` is kept as it is.
+func (b *Base) description(message string) string {
+	if b.result == nil || len(b.bodyTemplate) > 0 {
+		return message
+	}
+
+	headline, _, _ := strings.Cut(message, "\n\n")
+	return strings.TrimSuffix(headline, ":")
+}
+
+// finishedAt return the finished time of the run, or now when there is no result
+func finishedAt(rr *result.RunResult) time.Time {
+	if rr == nil || rr.FinishedAt.IsZero() {
+		return time.Now()
+	}
+
+	return rr.FinishedAt
+}
@@ -0,0 +1,80 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/result"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestResult return a finished run result for the rich formatted notifiers
+func newTestResult(err error) *result.RunResult {
+	rr := result.New("abc", "foo", "schedule")
+	rr.ArchiveSize = 2 * 1000 * 1000
+	rr.AddStorage("s3", "s3", 2*time.Second, err)
+	rr.Finish(err, false)
+	rr.StartedAt = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rr.FinishedAt = rr.StartedAt.Add(90 * time.Second)
+	rr.Duration = 90 * time.Second
+
+	return rr
+}
+
+func TestResultFields(t *testing.T) {
+	assert.Nil(t, resultFields(nil))
+	assert.Equal(t, colorUnknown, statusColor(nil))
+
+	rr := newTestResult(nil)
+	assert.Equal(t, colorSuccess, statusColor(rr))
+	assert.Equal(t, []field{
+		{Name: "Model", Value: "foo", Short: true},
+		{Name: "Status", Value: "succeeded", Short: true},
+		{Name: "Duration", Value: "1m30s", Short: true},
+		{Name: "Size", Value: "2.0 MB", Short: true},
+		{Name: "Storages", Value: "s3 (s3): succeeded in 2s"},
+	}, resultFields(rr))
+
+	rr = newTestResult(errors.New("access denied"))
+	rr.AddSkippedFile("/etc/shadow", "Permission denied")
+	assert.Equal(t, colorFailure, statusColor(rr))
+	assert.Equal(t, []field{
+		{Name: "Model", Value: "foo", Short: true},
+		{Name: "Status", Value: "failed", Short: true},
+		{Name: "Duration", Value: "1m30s", Short: true},
+		{Name: "Size", Value: "2.0 MB", Short: true},
+		{Name: "Storages", Value: "s3 (s3): failed, access denied"},
+		{Name: "Skipped files", Value: "1", Short: true},
+		{Name: "Error", Value: "access denied"},
+	}, resultFields(rr))
+}
+
+func TestDescription(t *testing.T) {
+	base := &Base{}
+	assert.Equal(t, "This is body", base.description("This is body"))
+
+	base.result = newTestResult(nil)
+	assert.Equal(t, "Backup of foo failed at 2024-05-01", base.description("Backup of foo failed at 2024-05-01:\n\nboom\n\nDuration: 1s"))
+
+	// The message of body_template is not cut
+	base.bodyTemplate = "{{ .Model }} is {{ .Status }}\n\nError: {{ .Error }}\n\nSee the runbook"
+	_, message := base.render(newTemplateData(config.ModelConfig{Name: "foo"}, base.result, "title", "message"))
+	assert.Equal(t, "foo is succeeded\n\nError: \n\nSee the runbook", base.description(message))
+}
@@ -0,0 +1,64 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type gotifyPayload struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotify send the message to Gotify, the priority is 4 on success and 8 on failure
+//
+// type: gotify
+// url: https://gotify.example.com
+// token: the-application-token
+func NewGotify(base *Base) *Webhook {
+	return &Webhook{
+		Base:        *base,
+		Service:     "Gotify",
+		method:      "POST",
+		contentType: "application/json",
+		buildWebhookURL: func(url string) (string, error) {
+			return strings.TrimSuffix(url, "/") + "/message", nil
+		},
+		buildBody: func(title, message string) ([]byte, error) {
+			return json.Marshal(gotifyPayload{
+				Title:    title,
+				Message:  message,
+				Priority: base.statusPriority(4, 8),
+			})
+		},
+		buildHeaders: func() map[string]string {
+			return map[string]string{
+				"X-Gotify-Key": base.viper.GetString("token"),
+			}
+		},
+		checkResult: func(status int, body []byte) error {
+			if status != 200 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Gotify(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("url", "https://gotify.example.com/")
+	base.viper.Set("token", "app-token")
+
+	s := NewGotify(base)
+	assert.Equal(t, "Gotify", s.Service)
+
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://gotify.example.com/message", url)
+	assert.Equal(t, "app-token", s.buildHeaders()["X-Gotify-Key"])
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"This is title","message":"This is body","priority":8}`, string(body))
+
+	// Override the priorities
+	base.result = newTestResult(nil)
+	base.viper.Set("success_priority", 1)
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"This is title","message":"This is body","priority":1}`, string(body))
+
+	base.viper.Set("priority", 10)
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"This is title","message":"This is body","priority":10}`, string(body))
+
+	assert.NoError(t, s.checkResult(200, []byte(`{"id":1}`)))
+	assert.EqualError(t, s.checkResult(401, []byte("unauthorized")), "status: 401, body: unauthorized")
+}
@@ -16,28 +16,116 @@
 package notifier
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"html"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
 	"net/smtp"
-	"sort"
+	"net/textproto"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
+)
+
+// TLS modes of the mail notifier
+const (
+	// mailTLSAuto use STARTTLS when the server supports it, like `smtp.SendMail`
+	mailTLSAuto = "auto"
+	// mailTLSStartTLS require STARTTLS
+	mailTLSStartTLS = "starttls"
+	// mailTLSImplicit connect with TLS, the default of port 465
+	mailTLSImplicit = "tls"
+	mailTLSNone     = "none"
+)
+
+// Auth mechanisms of the mail notifier
+const (
+	mailAuthPlain   = "plain"
+	mailAuthLogin   = "login"
+	mailAuthCRAMMD5 = "cram-md5"
+	mailAuthNone    = "none"
 )
 
+// mailDialTimeout the timeout of connecting to the SMTP server
+var mailDialTimeout = 30 * time.Second
+
+// Mail notifier
+//
+//	type: mail
+//	from: backup@example.com
+//	to: ops@example.com,dev@example.com
+//	cc: ...
+//	bcc: ...
+//	host: smtp.example.com
+//	port: 587
+//	username: backup@example.com
+//	password: your-password
+//	tls: auto | starttls | tls | none
+//	auth: plain | login | cram-md5 | none
+//	html: true
+//	attach_log: true
+//	log_lines: 200
 type Mail struct {
 	// Base is the base notifier
 	from     string
 	to       []string
+	cc       []string
+	bcc      []string
 	username string
 	password string
 	host     string
 	port     string
+
+	tls                string
+	auth               string
+	insecureSkipVerify bool
+
+	html      bool
+	attachLog bool
+	logLines  int
+
+	// result of the run, the log of the failed run is attached by `attach_log`
+	result *result.RunResult
 }
 
 func NewMail(base *Base) (*Mail, error) {
 	base.viper.SetDefault("port", "25")
+	base.viper.SetDefault("auth", mailAuthPlain)
+	base.viper.SetDefault("log_lines", 200)
+
+	port := base.viper.GetString("port")
+	if port == "465" {
+		base.viper.SetDefault("tls", mailTLSImplicit)
+	} else {
+		base.viper.SetDefault("tls", mailTLSAuto)
+	}
+
+	tlsMode := strings.ToLower(base.viper.GetString("tls"))
+	switch tlsMode {
+	case mailTLSAuto, mailTLSStartTLS, mailTLSImplicit, mailTLSNone:
+	default:
+		return nil, fmt.Errorf("invalid tls %q for mail notifier, must be auto, starttls, tls or none", tlsMode)
+	}
+
+	auth := strings.ToLower(base.viper.GetString("auth"))
+	switch auth {
+	case mailAuthPlain, mailAuthLogin, mailAuthCRAMMD5, mailAuthNone:
+	default:
+		return nil, fmt.Errorf("invalid auth %q for mail notifier, must be plain, login, cram-md5 or none", auth)
+	}
 
 	username := base.viper.GetString("username")
-	if len(username) == 0 {
+	if len(username) == 0 && auth != mailAuthNone {
 		return nil, fmt.Errorf("username is required for mail notifier")
 	}
 
@@ -47,58 +135,356 @@ func NewMail(base *Base) (*Mail, error) {
 	}
 
 	return &Mail{
-		username: username,
-		password: base.viper.GetString("password"),
-		to:       strings.Split(base.viper.GetString("to"), ","),
-		from:     from,
-		host:     base.viper.GetString("host"),
-		port:     base.viper.GetString("port"),
+		username:           username,
+		password:           base.viper.GetString("password"),
+		to:                 mailAddresses(base.viper.Get("to")),
+		cc:                 mailAddresses(base.viper.Get("cc")),
+		bcc:                mailAddresses(base.viper.Get("bcc")),
+		from:               from,
+		host:               base.viper.GetString("host"),
+		port:               port,
+		tls:                tlsMode,
+		auth:               auth,
+		insecureSkipVerify: base.viper.GetBool("insecure_skip_verify"),
+		html:               base.viper.GetBool("html"),
+		attachLog:          base.viper.GetBool("attach_log"),
+		logLines:           base.viper.GetInt("log_lines"),
+		result:             base.result,
 	}, nil
 }
 
+// mailAddresses parse the addresses, it's a list or a comma separated string
+func mailAddresses(value any) []string {
+	var items []string
+	switch v := value.(type) {
+	case string:
+		items = strings.Split(v, ",")
+	case []string:
+		items = v
+	case []any:
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+	}
+
+	var addresses []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			addresses = append(addresses, item)
+		}
+	}
+
+	return addresses
+}
+
 func (s Mail) getAddr() string {
-	return fmt.Sprintf("%s:%s", s.host, s.port)
+	return net.JoinHostPort(s.host, s.port)
 }
 
 func (s Mail) getAuth() smtp.Auth {
+	switch s.auth {
+	case mailAuthNone:
+		return nil
+	case mailAuthLogin:
+		return &loginAuth{username: s.username, password: s.password, host: s.host}
+	case mailAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(s.username, s.password)
+	}
+
 	return smtp.PlainAuth("", s.username, s.password, s.host)
 }
 
-func (s Mail) buildBody(title string, message string) string {
-	headers := make(map[string]string)
-	headers["From"] = s.from
-	headers["To"] = strings.Join(s.to, ",")
-	headers["Subject"] = title
-	headers["Content-Type"] = `text/plain; charset="utf-8"`
-	headers["Content-Transfer-Encoding"] = "base64"
+func (s Mail) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         s.host,
+		InsecureSkipVerify: s.insecureSkipVerify,
+	}
+}
 
-	// Sort headers by key
-	var keys []string
-	for k := range headers {
-		keys = append(keys, k)
+// buildBody build the MIME message, multipart when it has the HTML body or the attachment
+func (s Mail) buildBody(title string, message string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	now := time.Now()
+	headers := [][2]string{
+		{"From", s.from},
+		{"To", strings.Join(s.to, ", ")},
+	}
+	if len(s.cc) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(s.cc, ", ")})
+	}
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", title)},
+		[2]string{"Date", now.Format(time.RFC1123Z)},
+		[2]string{"Message-ID", s.messageID(now)},
+		[2]string{"MIME-Version", "1.0"},
+	)
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
 	}
-	sort.Strings(keys)
 
-	headerTexts := []string{}
+	var attachment []byte
+	if s.attachLog && isFailure(s.result) {
+		if lines := logger.RunTail(s.result.ID, s.logLines); len(lines) > 0 {
+			attachment = []byte(strings.Join(lines, "\n") + "\n")
+		}
+	}
+
+	if len(attachment) == 0 {
+		if err := s.writeContent(&buf, nil, title, message); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
 
-	for _, k := range keys {
-		headerTexts = append(headerTexts, fmt.Sprintf("%s: %s", k, headers[k]))
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+	if err := s.writeContent(&buf, mixed, title, message); err != nil {
+		return nil, err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {`text/plain; charset="utf-8"; name="vtsbackup.log"`},
+		"Content-Disposition":       {`attachment; filename="vtsbackup.log"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(part, attachment); err != nil {
+		return nil, err
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
 	}
 
-	return fmt.Sprintf("%s\n%s", strings.Join(headerTexts, "\n"), base64.StdEncoding.EncodeToString([]byte(message)))
+	return buf.Bytes(), nil
+}
+
+// writeContent write the text body, or the text and HTML alternatives, as a part of parent or the message itself when parent is nil
+func (s Mail) writeContent(buf *bytes.Buffer, parent *multipart.Writer, title, message string) error {
+	textHeader := textproto.MIMEHeader{
+		"Content-Type":              {`text/plain; charset="utf-8"`},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+
+	if !s.html {
+		if parent == nil {
+			for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+				fmt.Fprintf(buf, "%s: %s\r\n", key, textHeader.Get(key))
+			}
+			buf.WriteString("\r\n")
+			return writeBase64(buf, []byte(message))
+		}
+
+		part, err := parent.CreatePart(textHeader)
+		if err != nil {
+			return err
+		}
+		return writeBase64(part, []byte(message))
+	}
+
+	var alternative *multipart.Writer
+	if parent == nil {
+		alternative = multipart.NewWriter(buf)
+		fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", alternative.Boundary())
+	} else {
+		// The boundary is in the header of the part, so it's generated before the writer of the part
+		boundary := multipart.NewWriter(nil).Boundary()
+		part, err := parent.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", boundary)},
+		})
+		if err != nil {
+			return err
+		}
+		alternative = multipart.NewWriter(part)
+		if err := alternative.SetBoundary(boundary); err != nil {
+			return err
+		}
+	}
+
+	part, err := alternative.CreatePart(textHeader)
+	if err != nil {
+		return err
+	}
+	if err := writeBase64(part, []byte(message)); err != nil {
+		return err
+	}
+
+	part, err = alternative.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {`text/html; charset="utf-8"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeBase64(part, []byte(mailHTML(title, message))); err != nil {
+		return err
+	}
+
+	return alternative.Close()
+}
+
+// mailHTML the HTML body, the message is kept as preformatted text
+func mailHTML(title, message string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<body>
+<h3>%s</h3>
+<pre style="font-family: Menlo, Consolas, monospace; white-space: pre-wrap;">%s</pre>
+</body>
+</html>
+`, html.EscapeString(title), html.EscapeString(message))
+}
+
+// writeBase64 write the data in base64 with lines of 76 characters
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
+
+// messageID a unique Message-ID in the domain of the sender
+func (s Mail) messageID(now time.Time) string {
+	domain := s.host
+	if addr, err := mail.ParseAddress(s.from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	if len(domain) == 0 {
+		domain, _ = os.Hostname()
+	}
+
+	return fmt.Sprintf("<%d.%d@%s>", now.UnixNano(), rand.Int63(), domain)
+}
+
+// dial connect to the SMTP server, and upgrade to TLS by STARTTLS
+func (s Mail) dial() (*smtp.Client, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: mailDialTimeout}
+	if s.tls == mailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.getAddr(), s.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", s.getAddr())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.tls == mailTLSAuto || s.tls == mailTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(s.tlsConfig()); err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else if s.tls == mailTLSStartTLS {
+			client.Close()
+			return nil, errors.New("smtp: server doesn't support STARTTLS")
+		}
+	}
+
+	return client, nil
 }
 
 func (s *Mail) notify(title string, message string) error {
-	auth := s.getAuth()
+	body, err := s.buildBody(title, message)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if auth := s.getAuth(); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	from := s.from
+	if addr, err := mail.ParseAddress(s.from); err == nil {
+		from = addr.Address
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
 
-	// Connect to the server, authenticate, set the sender and recipient,
-	// and send the email all in one step.
-	to := s.to
+	for _, rcpt := range append(append(append([]string{}, s.to...), s.cc...), s.bcc...) {
+		if addr, err := mail.ParseAddress(rcpt); err == nil {
+			rcpt = addr.Address
+		}
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
 
-	err := smtp.SendMail(s.getAddr(), auth, s.from, to, []byte(s.buildBody(title, message)))
+	w, err := client.Data()
 	if err != nil {
 		return err
 	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// loginAuth the LOGIN mechanism, it's not in net/smtp but required by some servers, e.g. Office 365
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Same as PlainAuth, the password is only sent over TLS or to localhost
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+}
 
-	return nil
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
 }
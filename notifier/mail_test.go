@@ -16,8 +16,31 @@
 package notifier
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hantbk/vtsbackup/logger"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -41,6 +64,8 @@ func Test_Mail(t *testing.T) {
 	assert.Equal(t, "this-is-password", mail.password)
 	assert.Equal(t, "smtp.myhost.com", mail.host)
 	assert.Equal(t, "25", mail.port)
+	assert.Equal(t, mailTLSAuto, mail.tls)
+	assert.Equal(t, mailAuthPlain, mail.auth)
 
 	assert.Equal(t, "smtp.myhost.com:25", mail.getAddr())
 
@@ -49,6 +74,8 @@ func Test_Mail(t *testing.T) {
 
 	base.viper.Set("from", "from@myhost.com")
 	base.viper.Set("port", "587")
+	base.viper.Set("cc", []string{"cc@myhost.com"})
+	base.viper.Set("bcc", "bcc@myhost.com, bcc1@myhost.com")
 
 	mail, err = NewMail(&base)
 	assert.Nil(t, err)
@@ -56,7 +83,350 @@ func Test_Mail(t *testing.T) {
 	assert.Equal(t, "from@myhost.com", mail.from)
 	assert.Equal(t, "587", mail.port)
 	assert.Equal(t, "smtp.myhost.com:587", mail.getAddr())
+	assert.Equal(t, []string{"cc@myhost.com"}, mail.cc)
+	assert.Equal(t, []string{"bcc@myhost.com", "bcc1@myhost.com"}, mail.bcc)
 
-	body := mail.buildBody("This is title", "This is body")
-	assert.Equal(t, "Content-Transfer-Encoding: base64\nContent-Type: text/plain; charset=\"utf-8\"\nFrom: from@myhost.com\nSubject: This is title\nTo: to@myhost.com,to1@myhost.com\nVGhpcyBpcyBib2R5", body)
+	body, err := mail.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	msg := readMail(t, body)
+	assert.Equal(t, "from@myhost.com", msg.Header.Get("From"))
+	assert.Equal(t, "to@myhost.com, to1@myhost.com", msg.Header.Get("To"))
+	assert.Equal(t, "cc@myhost.com", msg.Header.Get("Cc"))
+	assert.Equal(t, "", msg.Header.Get("Bcc"))
+	assert.Equal(t, "This is title", msg.Header.Get("Subject"))
+	assert.Contains(t, msg.Header.Get("Message-ID"), "@myhost.com>")
+	date, err := msg.Header.Date()
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), date, 5*time.Second)
+	assert.Equal(t, `text/plain; charset="utf-8"`, msg.Header.Get("Content-Type"))
+	assert.Equal(t, "This is body", readBase64(t, msg.Body))
+
+	// port 465 is implicit TLS
+	base.viper.Set("port", "465")
+	mail, err = NewMail(&base)
+	assert.NoError(t, err)
+	assert.Equal(t, mailTLSImplicit, mail.tls)
+
+	base.viper.Set("tls", "ssl")
+	_, err = NewMail(&base)
+	assert.EqualError(t, err, `invalid tls "ssl" for mail notifier, must be auto, starttls, tls or none`)
+
+	// username is not required without auth
+	base = Base{viper: viper.New()}
+	base.viper.Set("auth", "none")
+	base.viper.Set("from", "from@myhost.com")
+	mail, err = NewMail(&base)
+	assert.NoError(t, err)
+	assert.Nil(t, mail.getAuth())
+}
+
+func Test_Mail_buildBody_multipart(t *testing.T) {
+	rr := newTestResult(errors.New("upload failed"))
+	ctx, endLog := logger.WithRun(context.Background(), rr.ID)
+	defer endLog()
+	logger.TagContext(ctx, "Model: foo").Info("This is the log of the run")
+	logger.Info("This is the log of another model")
+
+	base := Base{viper: viper.New(), result: rr}
+	base.viper.Set("username", "user@myhost.com")
+	base.viper.Set("to", "to@myhost.com")
+	base.viper.Set("html", true)
+	base.viper.Set("attach_log", true)
+
+	mail, err := NewMail(&base)
+	assert.NoError(t, err)
+
+	body, err := mail.buildBody("Backup <foo> 成功", "Line 1\nLine 2")
+	assert.NoError(t, err)
+	msg := readMail(t, body)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Backup <foo> 成功", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	mixed := multipart.NewReader(msg.Body, params["boundary"])
+	part, err := mixed.NextPart()
+	assert.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	alternative := multipart.NewReader(part, params["boundary"])
+	text, err := alternative.NextRawPart()
+	assert.NoError(t, err)
+	assert.Equal(t, `text/plain; charset="utf-8"`, text.Header.Get("Content-Type"))
+	assert.Equal(t, "Line 1\nLine 2", readBase64(t, text))
+	htmlPart, err := alternative.NextRawPart()
+	assert.NoError(t, err)
+	assert.Equal(t, `text/html; charset="utf-8"`, htmlPart.Header.Get("Content-Type"))
+	htmlBody := readBase64(t, htmlPart)
+	assert.Contains(t, htmlBody, "<h3>Backup &lt;foo&gt; 成功</h3>")
+	assert.Contains(t, htmlBody, ">Line 1\nLine 2</pre>")
+	_, err = alternative.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	attachment, err := mixed.NextRawPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "vtsbackup.log", attachment.FileName())
+	log := readBase64(t, attachment)
+	assert.Contains(t, log, "This is the log of the run")
+	assert.NotContains(t, log, "This is the log of another model")
+	_, err = mixed.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	// The log is only attached when the run fails
+	base.result = newTestResult(nil)
+	mail, err = NewMail(&base)
+	assert.NoError(t, err)
+	body, err = mail.buildBody("Backup foo", "Line 1")
+	assert.NoError(t, err)
+	msg = readMail(t, body)
+	mediaType, _, err = mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+}
+
+func Test_Mail_notify(t *testing.T) {
+	cases := []struct {
+		name     string
+		tls      string
+		auth     string
+		startTLS bool
+		implicit bool
+		wantAuth string
+		wantTLS  bool
+	}{
+		{name: "plain without TLS", tls: "auto", auth: "plain", wantAuth: "PLAIN \x00user@myhost.com\x00secret"},
+		{name: "starttls", tls: "starttls", auth: "login", startTLS: true, wantAuth: "LOGIN user@myhost.com secret", wantTLS: true},
+		{name: "auto starttls", tls: "auto", auth: "cram-md5", startTLS: true, wantAuth: "CRAM-MD5 user@myhost.com valid", wantTLS: true},
+		{name: "implicit tls", tls: "tls", auth: "none", implicit: true, wantTLS: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := &smtpServer{startTLS: c.startTLS, implicitTLS: c.implicit}
+			addr := server.start(t)
+			host, port, _ := net.SplitHostPort(addr)
+
+			base := Base{viper: viper.New()}
+			base.viper.Set("host", host)
+			base.viper.Set("port", port)
+			base.viper.Set("username", "user@myhost.com")
+			base.viper.Set("password", "secret")
+			base.viper.Set("from", "Backup <from@myhost.com>")
+			base.viper.Set("to", "to@myhost.com")
+			base.viper.Set("cc", "cc@myhost.com")
+			base.viper.Set("bcc", "bcc@myhost.com")
+			base.viper.Set("tls", c.tls)
+			base.viper.Set("auth", c.auth)
+			base.viper.Set("insecure_skip_verify", true)
+
+			mail, err := NewMail(&base)
+			assert.NoError(t, err)
+			assert.NoError(t, mail.notify("This is title", "This is body"))
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			assert.Equal(t, c.wantAuth, server.auth)
+			assert.Equal(t, c.wantTLS, server.tls)
+			assert.Equal(t, "from@myhost.com", server.from)
+			assert.Equal(t, []string{"to@myhost.com", "cc@myhost.com", "bcc@myhost.com"}, server.rcpts)
+
+			msg := readMail(t, []byte(server.data))
+			assert.Equal(t, "This is title", msg.Header.Get("Subject"))
+			assert.Equal(t, "This is body", readBase64(t, msg.Body))
+		})
+	}
+
+	// STARTTLS is required but not supported
+	server := &smtpServer{}
+	addr := server.start(t)
+	host, port, _ := net.SplitHostPort(addr)
+	base := Base{viper: viper.New()}
+	base.viper.Set("host", host)
+	base.viper.Set("port", port)
+	base.viper.Set("auth", "none")
+	base.viper.Set("from", "from@myhost.com")
+	base.viper.Set("to", "to@myhost.com")
+	base.viper.Set("tls", "starttls")
+	mail, err := NewMail(&base)
+	assert.NoError(t, err)
+	assert.EqualError(t, mail.notify("This is title", "This is body"), "smtp: server doesn't support STARTTLS")
+}
+
+func readMail(t *testing.T, body []byte) *mail.Message {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(body)))
+	assert.NoError(t, err)
+	return msg
+}
+
+func readBase64(t *testing.T, r io.Reader) string {
+	t.Helper()
+
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	assert.NoError(t, err)
+	return string(data)
+}
+
+// smtpServer a local SMTP stand-in, it records the auth, envelope and data of the last mail
+type smtpServer struct {
+	startTLS    bool
+	implicitTLS bool
+
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	auth      string
+	tls       bool
+	from      string
+	rcpts     []string
+	data      string
+}
+
+func (s *smtpServer) start(t *testing.T) string {
+	t.Helper()
+
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	isTLS := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		isTLS = true
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	readLine := func() string {
+		line, _ := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	decode := func(s string) string {
+		data, _ := base64.StdEncoding.DecodeString(s)
+		return string(data)
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line := readLine()
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch {
+		case cmd == "EHLO" || cmd == "HELO":
+			reply("250-localhost")
+			if s.startTLS && !isTLS {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN LOGIN CRAM-MD5")
+		case cmd == "STARTTLS":
+			reply("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			r = bufio.NewReader(conn)
+			isTLS = true
+		case strings.HasPrefix(line, "AUTH PLAIN"):
+			s.setAuth("PLAIN " + decode(strings.TrimPrefix(line, "AUTH PLAIN ")))
+			reply("235 Authenticated")
+		case line == "AUTH LOGIN":
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+			username := decode(readLine())
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+			password := decode(readLine())
+			s.setAuth("LOGIN " + username + " " + password)
+			reply("235 Authenticated")
+		case line == "AUTH CRAM-MD5":
+			challenge := "<123.456@localhost>"
+			reply("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+			parts := strings.SplitN(decode(readLine()), " ", 2)
+			d := hmac.New(md5.New, []byte("secret"))
+			d.Write([]byte(challenge))
+			result := "invalid"
+			if len(parts) == 2 && parts[1] == hex.EncodeToString(d.Sum(nil)) {
+				result = "valid"
+			}
+			s.setAuth("CRAM-MD5 " + parts[0] + " " + result)
+			reply("235 Authenticated")
+		case cmd == "MAIL":
+			s.mu.Lock()
+			s.tls = isTLS
+			s.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		case len(line) == 0:
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) setAuth(auth string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = auth
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
 }
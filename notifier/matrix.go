@@ -0,0 +1,84 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type matrixPayload struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// NewMatrix send the message to the Matrix room, the failure is sent as m.text to highlight, and the success as m.notice
+//
+// type: matrix
+// url: https://matrix.example.com
+// room_id: "!xxxxxxxx:example.com"
+// access_token: syt_xxxxxxxx
+func NewMatrix(base *Base) *Webhook {
+	return &Webhook{
+		Base:        *base,
+		Service:     "Matrix",
+		method:      "PUT",
+		contentType: "application/json",
+		buildWebhookURL: func(homeserver string) (string, error) {
+			roomID := base.viper.GetString("room_id")
+			if len(roomID) == 0 {
+				return "", fmt.Errorf("room_id is required for matrix notifier")
+			}
+
+			// The transaction ID makes the request idempotent
+			txnID := fmt.Sprintf("vtsbackup-%d", time.Now().UnixNano())
+
+			return fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+				strings.TrimSuffix(homeserver, "/"), url.PathEscape(roomID), txnID), nil
+		},
+		buildBody: func(title, message string) ([]byte, error) {
+			msgType := "m.notice"
+			if base.failure() {
+				msgType = "m.text"
+			}
+
+			return json.Marshal(matrixPayload{
+				MsgType:       msgType,
+				Body:          fmt.Sprintf("%s\n\n%s", title, message),
+				Format:        "org.matrix.custom.html",
+				FormattedBody: fmt.Sprintf("<strong>%s</strong><br><pre>%s</pre>", html.EscapeString(title), html.EscapeString(message)),
+			})
+		},
+		buildHeaders: func() map[string]string {
+			return map[string]string{
+				"Authorization": "Bearer " + base.viper.GetString("access_token"),
+			}
+		},
+		checkResult: func(status int, body []byte) error {
+			if status != 200 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
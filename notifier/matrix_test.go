@@ -0,0 +1,59 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Matrix(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("url", "https://matrix.example.com/")
+	base.viper.Set("access_token", "syt_xxxx")
+
+	s := NewMatrix(base)
+	assert.Equal(t, "Matrix", s.Service)
+	assert.Equal(t, "PUT", s.method)
+
+	_, err := s.webhookURL()
+	assert.EqualError(t, err, "room_id is required for matrix notifier")
+
+	base.viper.Set("room_id", "!room:example.com")
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^https://matrix.example.com/_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/vtsbackup-\d+$`, url)
+	assert.Equal(t, "Bearer syt_xxxx", s.buildHeaders()["Authorization"])
+
+	body, err := s.buildBody("This is title", "This is <body>")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"msgtype":"m.text","body":"This is title\n\nThis is \u003cbody\u003e","format":"org.matrix.custom.html",`+
+		`"formatted_body":"\u003cstrong\u003eThis is title\u003c/strong\u003e\u003cbr\u003e\u003cpre\u003eThis is \u0026lt;body\u0026gt;\u003c/pre\u003e"}`, string(body))
+
+	base.result = newTestResult(nil)
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"msgtype":"m.notice"`)
+
+	assert.NoError(t, s.checkResult(200, []byte(`{"event_id":"$xxx"}`)))
+	assert.EqualError(t, s.checkResult(403, []byte("forbidden")), "status: 403, body: forbidden")
+}
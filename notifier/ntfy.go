@@ -0,0 +1,88 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type ntfyPayload struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+const defaultNtfyURL = "https://ntfy.sh"
+
+// NewNtfy send the message to ntfy, the priority is 3 (default) on success and 5 (urgent) on failure
+//
+// type: ntfy
+// url: https://ntfy.sh
+// topic: backup
+// token: tk_xxxxxxxx
+// username: ...
+// password: ...
+func NewNtfy(base *Base) *Webhook {
+	base.viper.SetDefault("url", defaultNtfyURL)
+
+	return &Webhook{
+		Base:        *base,
+		Service:     "ntfy",
+		method:      "POST",
+		contentType: "application/json",
+		buildWebhookURL: func(url string) (string, error) {
+			// The topic is in the JSON body, so it's published to the root URL
+			return strings.TrimSuffix(url, "/"), nil
+		},
+		buildBody: func(title, message string) ([]byte, error) {
+			tag := "white_check_mark"
+			if base.failure() {
+				tag = "rotating_light"
+			}
+
+			return json.Marshal(ntfyPayload{
+				Topic:    base.viper.GetString("topic"),
+				Title:    title,
+				Message:  message,
+				Priority: base.statusPriority(3, 5),
+				Tags:     []string{tag},
+			})
+		},
+		buildHeaders: func() map[string]string {
+			headers := map[string]string{}
+			if token := base.viper.GetString("token"); len(token) > 0 {
+				headers["Authorization"] = "Bearer " + token
+			} else if username := base.viper.GetString("username"); len(username) > 0 {
+				credentials := username + ":" + base.viper.GetString("password")
+				headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+			}
+
+			return headers
+		},
+		checkResult: func(status int, body []byte) error {
+			if status != 200 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
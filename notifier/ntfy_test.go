@@ -0,0 +1,72 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Ntfy(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("topic", "backup")
+	base.viper.Set("token", "tk_xxxx")
+
+	s := NewNtfy(base)
+	assert.Equal(t, "ntfy", s.Service)
+	assert.Equal(t, "POST", s.method)
+
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ntfy.sh", url)
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"topic":"backup","title":"This is title","message":"This is body","priority":5,"tags":["rotating_light"]}`, string(body))
+	assert.Equal(t, "Bearer tk_xxxx", s.buildHeaders()["Authorization"])
+
+	base.result = newTestResult(nil)
+	base.viper.Set("url", "https://ntfy.example.com/")
+	base.viper.Set("token", "")
+	base.viper.Set("username", "user")
+	base.viper.Set("password", "pass")
+	s = NewNtfy(base)
+
+	url, err = s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ntfy.example.com", url)
+
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"topic":"backup","title":"This is title","message":"This is body","priority":3,"tags":["white_check_mark"]}`, string(body))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", s.buildHeaders()["Authorization"])
+
+	// The failure without the run
+	base.event = EventConfigReloadFailed
+	base.result = nil
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"topic":"backup","title":"This is title","message":"This is body","priority":5,"tags":["rotating_light"]}`, string(body))
+
+	assert.NoError(t, s.checkResult(200, []byte(`{"id":"xxx"}`)))
+	assert.EqualError(t, s.checkResult(403, []byte("forbidden")), "status: 403, body: forbidden")
+}
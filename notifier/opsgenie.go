@@ -0,0 +1,122 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+const defaultOpsgenieURL = "https://api.opsgenie.com"
+
+// NewOpsgenie send the alert to Opsgenie Alert API, the failure creates an alert and the success closes it
+//
+// type: opsgenie
+// url: https://api.opsgenie.com, or https://api.eu.opsgenie.com
+// api_key: the-api-key
+// priority: P1 | P2 | P3 | P4 | P5
+// tags: [backup]
+// dedup_key: vtsbackup-<model>
+func NewOpsgenie(base *Base) *Webhook {
+	base.viper.SetDefault("url", defaultOpsgenieURL)
+	base.viper.SetDefault("priority", "P2")
+
+	return &Webhook{
+		Base:        *base,
+		Service:     "Opsgenie",
+		method:      "POST",
+		contentType: "application/json",
+		buildWebhookURL: func(endpoint string) (string, error) {
+			triggered, err := base.incidentTriggered()
+			if err != nil {
+				return "", err
+			}
+
+			endpoint = strings.TrimSuffix(endpoint, "/")
+			if triggered {
+				return endpoint + "/v2/alerts", nil
+			}
+
+			alias, err := base.incidentKey()
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", endpoint, url.PathEscape(alias)), nil
+		},
+		buildBody: func(title, message string) ([]byte, error) {
+			triggered, err := base.incidentTriggered()
+			if err != nil {
+				return nil, err
+			}
+
+			alias, err := base.incidentKey()
+			if err != nil {
+				return nil, err
+			}
+			source, _ := os.Hostname()
+
+			if !triggered {
+				return json.Marshal(opsgenieClose{
+					Source: source,
+					Note:   title,
+				})
+			}
+
+			return json.Marshal(opsgenieAlert{
+				Message:     truncate(title, 130),
+				Alias:       alias,
+				Description: truncate(message, 15000),
+				Priority:    base.viper.GetString("priority"),
+				Source:      source,
+				Entity:      base.result.Model,
+				Tags:        base.viper.GetStringSlice("tags"),
+				Details:     resultDetails(base.result),
+			})
+		},
+		buildHeaders: func() map[string]string {
+			return map[string]string{
+				"Authorization": "GenieKey " + base.viper.GetString("api_key"),
+			}
+		},
+		checkResult: func(status int, body []byte) error {
+			if status != 202 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
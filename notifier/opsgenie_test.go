@@ -0,0 +1,85 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Opsgenie(t *testing.T) {
+	base := &Base{
+		Name:   "opsgenie",
+		viper:  viper.New(),
+		event:  EventFailed,
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("api_key", "api-key")
+	base.viper.Set("tags", []string{"backup"})
+
+	s := NewOpsgenie(base)
+	assert.Equal(t, "Opsgenie", s.Service)
+	assert.Equal(t, "GenieKey api-key", s.buildHeaders()["Authorization"])
+
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.opsgenie.com/v2/alerts", url)
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+
+	var alert opsgenieAlert
+	assert.NoError(t, json.Unmarshal(body, &alert))
+	host, _ := os.Hostname()
+	assert.Equal(t, "This is title", alert.Message)
+	assert.Equal(t, "vtsbackup-foo", alert.Alias)
+	assert.Equal(t, "This is body", alert.Description)
+	assert.Equal(t, "P2", alert.Priority)
+	assert.Equal(t, host, alert.Source)
+	assert.Equal(t, "foo", alert.Entity)
+	assert.Equal(t, []string{"backup"}, alert.Tags)
+	assert.Equal(t, "access denied", alert.Details["Error"])
+	assert.Equal(t, "schedule", alert.Details["Trigger"])
+
+	// The success closes the alert by the alias
+	base.event = EventSucceeded
+	base.result = newTestResult(nil)
+	base.viper.Set("url", "https://api.eu.opsgenie.com/")
+	s = NewOpsgenie(base)
+
+	url, err = s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.eu.opsgenie.com/v2/alerts/vtsbackup-foo/close?identifierType=alias", url)
+
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"source":"`+host+`","note":"This is title"}`, string(body))
+
+	// The pruned backups of the succeeded run don't close the alert
+	base.event = EventPruned
+	_, err = s.webhookURL()
+	assert.EqualError(t, err, `event "pruned" is not supported by opsgenie notifier`)
+	_, err = s.buildBody("This is title", "This is body")
+	assert.EqualError(t, err, `event "pruned" is not supported by opsgenie notifier`)
+
+	assert.NoError(t, s.checkResult(202, []byte(`{"result":"Request will be processed"}`)))
+	assert.EqualError(t, s.checkResult(422, []byte("invalid")), "status: 422, body: invalid")
+}
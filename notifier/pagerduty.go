@@ -0,0 +1,111 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Component     string            `json:"component"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+const defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// NewPagerDuty send the event to PagerDuty Events API v2, the failure triggers an incident and the success resolves it
+//
+// type: pagerduty
+// routing_key: the-integration-key
+// severity: critical | error | warning | info
+// dedup_key: vtsbackup-<model>
+func NewPagerDuty(base *Base) *Webhook {
+	base.viper.SetDefault("url", defaultPagerDutyURL)
+	base.viper.SetDefault("severity", "error")
+
+	return &Webhook{
+		Base:        *base,
+		Service:     "PagerDuty",
+		method:      "POST",
+		contentType: "application/json",
+		buildBody: func(title, message string) ([]byte, error) {
+			triggered, err := base.incidentTriggered()
+			if err != nil {
+				return nil, err
+			}
+
+			dedupKey, err := base.incidentKey()
+			if err != nil {
+				return nil, err
+			}
+
+			event := pagerDutyEvent{
+				RoutingKey:  base.viper.GetString("routing_key"),
+				EventAction: "resolve",
+				DedupKey:    dedupKey,
+			}
+
+			if triggered {
+				source, _ := os.Hostname()
+				details := resultDetails(base.result)
+				details["Message"] = message
+
+				event.EventAction = "trigger"
+				event.Payload = &pagerDutyPayload{
+					Summary:       truncate(title, 1024),
+					Source:        source,
+					Severity:      base.viper.GetString("severity"),
+					Timestamp:     finishedAt(base.result).UTC().Format(time.RFC3339),
+					Component:     base.result.Model,
+					CustomDetails: details,
+				}
+			}
+
+			return json.Marshal(event)
+		},
+		checkResult: func(status int, body []byte) error {
+			if status != 202 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
+
+// truncate the text to at most n runes
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,98 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PagerDuty(t *testing.T) {
+	base := &Base{
+		Name:   "pagerduty",
+		viper:  viper.New(),
+		event:  EventFailed,
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("routing_key", "routing-key")
+
+	s := NewPagerDuty(base)
+	assert.Equal(t, "PagerDuty", s.Service)
+
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://events.pagerduty.com/v2/enqueue", url)
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+
+	var event pagerDutyEvent
+	assert.NoError(t, json.Unmarshal(body, &event))
+	host, _ := os.Hostname()
+	assert.Equal(t, "routing-key", event.RoutingKey)
+	assert.Equal(t, "trigger", event.EventAction)
+	assert.Equal(t, "vtsbackup-foo", event.DedupKey)
+	assert.Equal(t, "This is title", event.Payload.Summary)
+	assert.Equal(t, host, event.Payload.Source)
+	assert.Equal(t, "error", event.Payload.Severity)
+	assert.Equal(t, "2024-05-01T00:01:30Z", event.Payload.Timestamp)
+	assert.Equal(t, "foo", event.Payload.Component)
+	assert.Equal(t, "failed", event.Payload.CustomDetails["Status"])
+	assert.Equal(t, "access denied", event.Payload.CustomDetails["Error"])
+	assert.Equal(t, "abc", event.Payload.CustomDetails["Run ID"])
+	assert.Equal(t, "This is body", event.Payload.CustomDetails["Message"])
+
+	// The success resolves the incident with the same dedup key
+	base.event = EventSucceeded
+	base.result = newTestResult(nil)
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"routing_key":"routing-key","event_action":"resolve","dedup_key":"vtsbackup-foo"}`, string(body))
+
+	base.viper.Set("dedup_key", "db-backup")
+	body, err = s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"routing_key":"routing-key","event_action":"resolve","dedup_key":"db-backup"}`, string(body))
+
+	// The other events neither trigger nor resolve the incident, even with the dedup key
+	for _, event := range []string{EventStarted, EventWarning, EventPruned, EventConfigReloadFailed, ""} {
+		base.event = event
+		_, err = s.buildBody("This is title", "This is body")
+		assert.EqualError(t, err, fmt.Sprintf("event %q is not supported by pagerduty notifier", event))
+	}
+
+	base.event = EventSucceeded
+	base.result = nil
+	base.viper.Set("dedup_key", "")
+	_, err = s.buildBody("This is title", "This is body")
+	assert.EqualError(t, err, "the run result is required for pagerduty notifier")
+
+	assert.NoError(t, s.checkResult(202, []byte(`{"status":"success"}`)))
+	respBody := `{"status":"invalid event","message":"Event object is invalid"}`
+	assert.EqualError(t, s.checkResult(400, []byte(respBody)), "status: 400, body: "+respBody)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "foo", truncate("foo", 3))
+	assert.Equal(t, "fo…", truncate("foobar", 3))
+	assert.Equal(t, "成功…", truncate("成功成功", 3))
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type pushoverPayload struct {
+	Token     string `json:"token"`
+	User      string `json:"user"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Priority  int    `json:"priority"`
+	Device    string `json:"device,omitempty"`
+	Sound     string `json:"sound,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type pushoverResponse struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+const defaultPushoverURL = "https://api.pushover.net/1/messages.json"
+
+// NewPushover send the message to Pushover, the priority is 0 (normal) on success and 1 (high) on failure
+//
+// type: pushover
+// token: the-application-token
+// user: the-user-or-group-key
+// device: iphone
+// sound: siren
+func NewPushover(base *Base) *Webhook {
+	base.viper.SetDefault("url", defaultPushoverURL)
+
+	return &Webhook{
+		Base:        *base,
+		Service:     "Pushover",
+		method:      "POST",
+		contentType: "application/json",
+		buildBody: func(title, message string) ([]byte, error) {
+			return json.Marshal(pushoverPayload{
+				Token:     base.viper.GetString("token"),
+				User:      base.viper.GetString("user"),
+				Title:     title,
+				Message:   message,
+				Priority:  base.statusPriority(0, 1),
+				Device:    base.viper.GetString("device"),
+				Sound:     base.viper.GetString("sound"),
+				Timestamp: finishedAt(base.result).Unix(),
+			})
+		},
+		checkResult: func(status int, body []byte) error {
+			var resp pushoverResponse
+			if err := json.Unmarshal(body, &resp); err != nil || status != 200 || resp.Status != 1 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Pushover(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(errors.New("access denied")),
+	}
+	base.viper.Set("token", "app-token")
+	base.viper.Set("user", "user-key")
+	base.viper.Set("sound", "siren")
+
+	s := NewPushover(base)
+	assert.Equal(t, "Pushover", s.Service)
+
+	url, err := s.webhookURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.pushover.net/1/messages.json", url)
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"token":"app-token","user":"user-key","title":"This is title","message":"This is body","priority":1,"sound":"siren","timestamp":1714521690}`, string(body))
+
+	assert.NoError(t, s.checkResult(200, []byte(`{"status":1,"request":"xxx"}`)))
+	respBody := `{"user":"invalid","errors":["user identifier is invalid"],"status":0}`
+	assert.EqualError(t, s.checkResult(400, []byte(respBody)), "status: 400, body: "+respBody)
+}
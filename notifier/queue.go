@@ -0,0 +1,361 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// queuePath the database of the failed notifications, it's opened for each operation like history,
+	// so `vtsbackup notify-queue` is able to read it while the agent is running.
+	queuePath   = filepath.Join(config.VtsBackupDir, "notify_queue.db")
+	queueBucket = []byte("notifications")
+
+	queueOpenTimeout = 5 * time.Second
+
+	// retryMu only one retry of the queue at a time in this process, the lock file guards it across the processes
+	retryMu sync.Mutex
+)
+
+// QueuedNotification a failed notification waiting to be retried
+type QueuedNotification struct {
+	ID       uint64 `json:"id"`
+	Model    string `json:"model"`
+	Notifier string `json:"notifier"`
+	// Event of the notification, it's empty for the digest
+	Event   string `json:"event,omitempty"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Result of the run, the rich formatted notifiers build the fields from it
+	Result    *result.RunResult `json:"result,omitempty"`
+	Attempts  int               `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+	NextAt    time.Time         `json:"next_at"`
+	LastError string            `json:"last_error"`
+}
+
+// Expired check the notification is older than `notify_queue.max_age`
+func (n QueuedNotification) Expired(now time.Time) bool {
+	return config.NotifyQueue.MaxAge > 0 && now.Sub(n.CreatedAt) > config.NotifyQueue.MaxAge
+}
+
+func openQueue() (*bolt.DB, error) {
+	if err := helper.MkdirP(filepath.Dir(queuePath)); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(queuePath, 0600, &bolt.Options{Timeout: queueOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open notify queue %s: %v", queuePath, err)
+	}
+
+	return db, nil
+}
+
+// enqueue the failed notification, it will be retried after `notify_queue.delay`
+func enqueue(model, name, event, title, message string, rr *result.RunResult, sendErr error) error {
+	now := time.Now()
+	n := QueuedNotification{
+		Model:     model,
+		Notifier:  name,
+		Event:     event,
+		Title:     title,
+		Message:   message,
+		Result:    rr,
+		Attempts:  1,
+		CreatedAt: now,
+		NextAt:    now.Add(config.NotifyQueue.DelayOf(1)),
+		LastError: sendErr.Error(),
+	}
+
+	db, err := openQueue()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(queueBucket)
+		if err != nil {
+			return err
+		}
+
+		n.ID, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return putQueued(bucket, n)
+	})
+}
+
+func putQueued(bucket *bolt.Bucket, n QueuedNotification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(queueKey(n.ID), data)
+}
+
+// Queue list the queued notifications, oldest first
+func Queue() ([]QueuedNotification, error) {
+	items := []QueuedNotification{}
+
+	if _, err := os.Stat(queuePath); os.IsNotExist(err) {
+		return items, nil
+	}
+
+	db, err := openQueue()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queueBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var n QueuedNotification
+			if err := json.Unmarshal(v, &n); err != nil {
+				return fmt.Errorf("invalid queued notification %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			items = append(items, n)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// lockRetry hold the lock of the retry across the processes, e.g. `vtsbackup notify-queue --flush` and the daemon
+func lockRetry() (unlock func(), err error) {
+	if err := helper.MkdirP(filepath.Dir(queuePath)); err != nil {
+		return nil, err
+	}
+
+	lockPath := queuePath + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %s: %v", lockPath, err)
+	}
+
+	if err := helper.LockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %v", lockPath, err)
+	}
+
+	return func() {
+		helper.UnlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// superseded check a newer notification of the run is sent to the notifier since n is queued,
+// e.g. a queued trigger of PagerDuty must not reopen the incident after the recovery is sent.
+func (n QueuedNotification) superseded() bool {
+	if !runEvents[n.Event] {
+		return false
+	}
+
+	return getNotifyState(n.Model, n.Notifier).LastSentAt.After(n.CreatedAt)
+}
+
+// markQueuedSent record the queued notification of the run is sent, unless a newer one is already sent
+func markQueuedSent(n QueuedNotification) error {
+	if !runEvents[n.Event] {
+		return nil
+	}
+
+	return updateNotifyState(n.Model, n.Notifier, func(state *notifyState) {
+		if state.LastSentAt.After(n.CreatedAt) {
+			return
+		}
+
+		state.LastSentAt = n.CreatedAt
+		if n.Result != nil {
+			state.LastStatus = n.Result.Status
+		}
+	})
+}
+
+// RetryQueue send the due notifications in the queue, all of them when force is true.
+// The sent, expired and superseded ones are removed, the failed ones are delayed by the backoff.
+func RetryQueue(force bool) (sent int, err error) {
+	logger := logger.Tag("Notifier Queue")
+
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	unlock, err := lockRetry()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	items, err := Queue()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var removed []uint64
+	var updated []QueuedNotification
+	for _, n := range items {
+		if n.Expired(now) {
+			logger.Warnf("Drop the notification %d of %s to %s, it's not sent after %s: %s", n.ID, n.Model, n.Notifier, config.NotifyQueue.MaxAge, n.LastError)
+			removed = append(removed, n.ID)
+			continue
+		}
+
+		if n.superseded() {
+			logger.Infof("Drop the notification %d of %s to %s, a newer one is sent", n.ID, n.Model, n.Notifier)
+			removed = append(removed, n.ID)
+			continue
+		}
+
+		if !force && n.NextAt.After(now) {
+			continue
+		}
+
+		notifier, err := queuedNotifier(n)
+		if err != nil {
+			logger.Warnf("Drop the notification %d: %v", n.ID, err)
+			removed = append(removed, n.ID)
+			continue
+		}
+
+		if err := notifier.notify(n.Title, n.Message); err != nil {
+			n.Attempts++
+			n.LastError = err.Error()
+			n.NextAt = time.Now().Add(config.NotifyQueue.DelayOf(n.Attempts))
+			logger.Errorf("Retry the notification %d of %s to %s failed (attempt %d), next at %s: %v", n.ID, n.Model, n.Notifier, n.Attempts, n.NextAt.Format(time.RFC3339), err)
+			updated = append(updated, n)
+			continue
+		}
+
+		logger.Infof("Notification %d of %s to %s is sent after %d attempts", n.ID, n.Model, n.Notifier, n.Attempts+1)
+		if err := markQueuedSent(n); err != nil {
+			logger.Errorf("Failed to save notify state: %v", err)
+		}
+		removed = append(removed, n.ID)
+		sent++
+	}
+
+	if len(removed) == 0 && len(updated) == 0 {
+		return sent, nil
+	}
+
+	db, err := openQueue()
+	if err != nil {
+		return sent, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queueBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		for _, id := range removed {
+			if err := bucket.Delete(queueKey(id)); err != nil {
+				return err
+			}
+		}
+		for _, n := range updated {
+			if err := putQueued(bucket, n); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return sent, err
+}
+
+// PurgeQueue remove all the queued notifications, return the number of them
+func PurgeQueue() (int, error) {
+	items, err := Queue()
+	if err != nil || len(items) == 0 {
+		return 0, err
+	}
+
+	db, err := openQueue()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(queueBucket) == nil {
+			return nil
+		}
+		return tx.DeleteBucket(queueBucket)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
+
+// queuedNotifier create the notifier from current config, it's an error when the model or notifier is removed
+func queuedNotifier(n QueuedNotification) (Notifier, error) {
+	model := config.GetModelConfigByName(n.Model)
+	if model == nil {
+		return nil, fmt.Errorf("model %s is not found", n.Model)
+	}
+
+	subConfig, ok := model.Notifiers[n.Notifier]
+	if !ok {
+		return nil, fmt.Errorf("notifier %s of %s is not found", n.Notifier, n.Model)
+	}
+
+	notifier, base, err := newNotifier(n.Notifier, subConfig, n.Result)
+	if err != nil {
+		return nil, err
+	}
+	base.event = n.Event
+
+	return notifier, nil
+}
+
+func queueKey(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
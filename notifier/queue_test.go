@@ -0,0 +1,193 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	queuePath = filepath.Join(t.TempDir(), "notify_queue.db")
+	notifyStatePath = filepath.Join(t.TempDir(), "notify_state.json")
+	config.NotifyQueue = config.NotifyQueueConfig{Enabled: true, Delay: time.Minute, Backoff: 2, MaxAge: time.Hour}
+
+	var available atomic.Bool
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	webhookViper := viper.New()
+	webhookViper.Set("url", server.URL)
+	model := config.ModelConfig{
+		Name: "foo",
+		Notifiers: map[string]config.SubConfig{
+			"webhook": {Name: "webhook", Type: "webhook", Viper: webhookViper},
+		},
+	}
+
+	models := config.Models
+	config.Models = []config.ModelConfig{model}
+	defer func() { config.Models = models }()
+
+	items, err := Queue()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	Failure(model, newTestResult(errors.New("upload failed")))
+
+	items, err = Queue()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "foo", items[0].Model)
+	assert.Equal(t, "webhook", items[0].Notifier)
+	assert.Equal(t, "[Backup] Err: Backup foo has failed", items[0].Title)
+	assert.Equal(t, 1, items[0].Attempts)
+	assert.Equal(t, "status: 502, body: ", items[0].LastError)
+	assert.Equal(t, "upload failed", items[0].Result.Error)
+
+	// Not due yet
+	sent, err := RetryQueue(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	// Still failed, delayed by the backoff
+	sent, err = RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	items, _ = Queue()
+	assert.Len(t, items, 1)
+	assert.Equal(t, 2, items[0].Attempts)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), items[0].NextAt, 5*time.Second)
+
+	available.Store(true)
+	sent, err = RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, int32(1), received.Load())
+	items, _ = Queue()
+	assert.Empty(t, items)
+
+	// Expired and removed notifiers are dropped
+	assert.NoError(t, enqueue("foo", "webhook", "", "title", "message", nil, errors.New("timeout")))
+	assert.NoError(t, enqueue("foo", "removed", "", "title", "message", nil, errors.New("timeout")))
+	config.NotifyQueue.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	sent, err = RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	items, _ = Queue()
+	assert.Empty(t, items)
+	assert.Equal(t, int32(1), received.Load())
+
+	// Purge
+	config.NotifyQueue.MaxAge = time.Hour
+	assert.NoError(t, enqueue("foo", "webhook", "", "title", "message", nil, errors.New("timeout")))
+	count, err := PurgeQueue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	items, _ = Queue()
+	assert.Empty(t, items)
+}
+
+func TestRetryQueue_superseded(t *testing.T) {
+	queuePath = filepath.Join(t.TempDir(), "notify_queue.db")
+	notifyStatePath = filepath.Join(t.TempDir(), "notify_state.json")
+	config.NotifyQueue = config.NotifyQueueConfig{Enabled: true, Delay: time.Minute, Backoff: 2, MaxAge: time.Hour}
+
+	var available, failureAvailable atomic.Bool
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !available.Load() || (!failureAvailable.Load() && strings.Contains(string(body), "has failed")) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	webhookViper := viper.New()
+	webhookViper.Set("url", server.URL)
+	model := config.ModelConfig{
+		Name: "foo",
+		Notifiers: map[string]config.SubConfig{
+			"webhook": {Name: "webhook", Type: "webhook", Viper: webhookViper},
+		},
+	}
+
+	models := config.Models
+	config.Models = []config.ModelConfig{model}
+	defer func() { config.Models = models }()
+
+	Failure(model, newTestResult(errors.New("upload failed")))
+	items, _ := Queue()
+	assert.Len(t, items, 1)
+	assert.Equal(t, EventFailed, items[0].Event)
+
+	// The recovery is sent before the queued failure is retried
+	available.Store(true)
+	failureAvailable.Store(true)
+	Success(model, newTestResult(nil))
+	assert.Equal(t, int32(1), received.Load())
+
+	sent, err := RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, int32(1), received.Load())
+	items, _ = Queue()
+	assert.Empty(t, items)
+
+	// The older failure is still failed when the recovery queued after it is sent, it's dropped in the next retry
+	available.Store(false)
+	failureAvailable.Store(false)
+	Failure(model, newTestResult(errors.New("upload failed")))
+	Success(model, newTestResult(nil))
+	items, _ = Queue()
+	assert.Len(t, items, 2)
+
+	available.Store(true)
+	sent, err = RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, int32(2), received.Load())
+	assert.Equal(t, "succeeded", getNotifyState("foo", "webhook").LastStatus)
+
+	failureAvailable.Store(true)
+	sent, err = RetryQueue(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, int32(2), received.Load())
+	items, _ = Queue()
+	assert.Empty(t, items)
+}
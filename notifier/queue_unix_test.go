@@ -0,0 +1,56 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build unix
+
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryQueue_lock(t *testing.T) {
+	queuePath = filepath.Join(t.TempDir(), "notify_queue.db")
+	notifyStatePath = filepath.Join(t.TempDir(), "notify_state.json")
+	config.NotifyQueue = config.NotifyQueueConfig{Enabled: true, Delay: time.Minute, Backoff: 2, MaxAge: time.Hour}
+
+	// Hold the lock like `vtsbackup notify-queue --flush` in another process
+	f, err := os.OpenFile(queuePath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, helper.LockFile(f))
+
+	done := make(chan error)
+	go func() {
+		_, err := RetryQueue(true)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the queue is retried while it's locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, helper.UnlockFile(f))
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,53 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Slack(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(nil),
+	}
+
+	s := NewSlack(base)
+	assert.Equal(t, "Slack", s.Service)
+	assert.Equal(t, "POST", s.method)
+	assert.Equal(t, "application/json", s.contentType)
+
+	body, err := s.buildBody("This is title", "This is body\n\nDuration: 1m30s")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"text":"This is title","attachments":[{"color":"#2EB886","title":"This is title","text":"This is body",`+
+		`"fields":[{"title":"Model","value":"foo","short":true},{"title":"Status","value":"succeeded","short":true},`+
+		`{"title":"Duration","value":"1m30s","short":true},{"title":"Size","value":"2.0 MB","short":true},`+
+		`{"title":"Storages","value":"s3 (s3): succeeded in 2s","short":false}],"ts":1714521690}]}`, string(body))
+
+	base.result = nil
+	body, err = NewSlack(base).buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"color":"#808080","title":"This is title","text":"This is body","ts":`)
+
+	err = s.checkResult(200, []byte("ok"))
+	assert.NoError(t, err)
+
+	err = s.checkResult(404, []byte("no_team"))
+	assert.EqualError(t, err, "status: 404, body: no_team")
+}
@@ -0,0 +1,83 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type teamsPayload struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text,omitempty"`
+	Sections   []teamsSection `json:"sections,omitempty"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewTeams send the message card to Microsoft Teams Incoming Webhook
+//
+// type: teams
+// url: https://xxx.webhook.office.com/webhookb2/xxx
+func NewTeams(base *Base) *Webhook {
+	return &Webhook{
+		Base:        *base,
+		Service:     "Teams",
+		method:      "POST",
+		contentType: "application/json",
+		buildBody: func(title, message string) ([]byte, error) {
+			payload := teamsPayload{
+				Type:       "MessageCard",
+				Context:    "http://schema.org/extensions",
+				ThemeColor: fmt.Sprintf("%06X", base.color()),
+				Summary:    title,
+				Title:      title,
+				Text:       base.description(message),
+			}
+
+			if fields := resultFields(base.result); len(fields) > 0 {
+				section := teamsSection{}
+				for _, f := range fields {
+					// Line breaks of the markdown in facts
+					section.Facts = append(section.Facts, teamsFact{Name: f.Name, Value: strings.ReplaceAll(f.Value, "\n", "<br>")})
+				}
+				payload.Sections = append(payload.Sections, section)
+			}
+
+			return json.Marshal(payload)
+		},
+		checkResult: func(status int, body []byte) error {
+			// 200 by the Office 365 connector, 202 by the Workflows (Power Automate) webhook
+			if status < 200 || status >= 300 {
+				return fmt.Errorf("status: %d, body: %s", status, string(body))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Teams(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(nil),
+	}
+	base.result.AddStorage("ftp", "ftp", 0, nil)
+
+	s := NewTeams(base)
+	assert.Equal(t, "Teams", s.Service)
+	assert.Equal(t, "POST", s.method)
+	assert.Equal(t, "application/json", s.contentType)
+
+	body, err := s.buildBody("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"@type":"MessageCard","@context":"http://schema.org/extensions","themeColor":"2EB886",`+
+		`"summary":"This is title","title":"This is title","text":"This is body","sections":[{"facts":[`+
+		`{"name":"Model","value":"foo"},{"name":"Status","value":"succeeded"},{"name":"Duration","value":"1m30s"},`+
+		`{"name":"Size","value":"2.0 MB"},{"name":"Storages","value":"s3 (s3): succeeded in 2s\u003cbr\u003eftp (ftp): succeeded in 0s"}]}]}`, string(body))
+
+	assert.NoError(t, s.checkResult(200, []byte("1")))
+	assert.NoError(t, s.checkResult(202, nil))
+
+	err = s.checkResult(400, []byte("Bad payload"))
+	assert.EqualError(t, err, "status: 400, body: Bad payload")
+}
@@ -16,52 +16,197 @@
 package notifier
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"strings"
 
 	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/logger"
 )
 
 type telegramPayload struct {
-	ChatID string `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID              string `json:"chat_id"`
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode,omitempty"`
+	MessageThreadID     int    `json:"message_thread_id,omitempty"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
 }
 
 const DEFAULT_TELEGRAM_ENDPOINT = "api.telegram.org"
 
-func NewTelegram(base *Base) *Webhook {
-	return &Webhook{
+// telegramMarkdownV2Escaper escape the special characters of MarkdownV2
+var telegramMarkdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "~", "\\~", "`", "\\`",
+	">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// Telegram send the message by Bot API, and the log by `sendDocument` when the run is failed
+//
+// type: telegram
+// token: 123456:xxxxxxxx
+// chat_id: "@my_channel"
+// parse_mode: HTML | MarkdownV2
+// message_thread_id: 123
+// disable_notification: true
+// attach_log: true
+// log_lines: 200
+type Telegram struct {
+	*Webhook
+	base *Base
+}
+
+func NewTelegram(base *Base) *Telegram {
+	base.viper.SetDefault("log_lines", 200)
+
+	return &Telegram{Webhook: &Webhook{
 		Base:        *base,
 		Service:     "Telegram",
 		method:      "POST",
 		contentType: "application/json",
 		buildWebhookURL: func(url string) (string, error) {
-			token := base.viper.GetString("token")
-			endpoint := DEFAULT_TELEGRAM_ENDPOINT
-			if base.viper.IsSet("endpoint") {
-				endpoint = base.viper.GetString("endpoint")
-			}
-
-			endpoint = helper.FormatEndpoint(endpoint)
-
-			return fmt.Sprintf("%s/bot%s/sendMessage", endpoint, token), nil
+			return telegramAPI(base, "sendMessage"), nil
 		},
 		buildBody: func(title, message string) ([]byte, error) {
 			chat_id := base.viper.GetString("chat_id")
 
+			text, parseMode, err := telegramText(base.viper.GetString("parse_mode"), title, message)
+			if err != nil {
+				return nil, err
+			}
+
 			payload := telegramPayload{
-				ChatID: chat_id,
-				Text:   fmt.Sprintf("%s\n\n%s", title, message),
+				ChatID:          chat_id,
+				Text:            text,
+				ParseMode:       parseMode,
+				MessageThreadID: base.viper.GetInt("message_thread_id"),
+				// Only the successes are silent
+				DisableNotification: base.viper.GetBool("disable_notification") && !base.failure(),
 			}
 
 			return json.Marshal(payload)
 		},
-		checkResult: func(status int, body []byte) error {
-			if status != 200 {
-				return fmt.Errorf("status: %d, body: %s", status, string(body))
-			}
+		checkResult: telegramCheckResult,
+	}, base: base}
+}
 
-			return nil
-		},
+func telegramCheckResult(status int, body []byte) error {
+	if status != 200 {
+		return fmt.Errorf("status: %d, body: %s", status, string(body))
 	}
+
+	return nil
+}
+
+// telegramAPI return the URL of the Bot API method
+func telegramAPI(base *Base, method string) string {
+	token := base.viper.GetString("token")
+	endpoint := DEFAULT_TELEGRAM_ENDPOINT
+	if base.viper.IsSet("endpoint") {
+		endpoint = base.viper.GetString("endpoint")
+	}
+
+	endpoint = helper.FormatEndpoint(endpoint)
+
+	return fmt.Sprintf("%s/bot%s/%s", endpoint, token, method)
+}
+
+// telegramText format the text by the parse mode, the title is bold
+func telegramText(parseMode, title, message string) (string, string, error) {
+	switch strings.ToLower(parseMode) {
+	case "":
+		return fmt.Sprintf("%s\n\n%s", title, message), "", nil
+	case "html":
+		return fmt.Sprintf("<b>%s</b>\n\n%s", html.EscapeString(title), html.EscapeString(message)), "HTML", nil
+	case "markdownv2":
+		return fmt.Sprintf("*%s*\n\n%s", telegramMarkdownV2Escaper.Replace(title), telegramMarkdownV2Escaper.Replace(message)), "MarkdownV2", nil
+	}
+
+	return "", "", fmt.Errorf("invalid parse_mode %q for telegram notifier, must be HTML or MarkdownV2", parseMode)
+}
+
+func (s *Telegram) notify(title string, message string) error {
+	if err := s.Webhook.notify(title, message); err != nil {
+		return err
+	}
+
+	// The message is sent, the failed log is not retried with the message by the queue
+	if s.base.viper.GetBool("attach_log") && isFailure(s.base.result) {
+		if err := s.sendLog(title); err != nil {
+			s.getLogger().Errorf("Failed to send the log: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// sendLog send the tail of the log of the run as a document, nothing is sent when the run is finished,
+// e.g. the message is retried by the queue
+func (s *Telegram) sendLog(caption string) error {
+	lines := logger.RunTail(s.base.result.ID, s.base.viper.GetInt("log_lines"))
+	if len(lines) == 0 {
+		return nil
+	}
+
+	logger := s.getLogger()
+
+	body, contentType, err := s.buildDocument(caption, []byte(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+
+	client, err := s.httpClient()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Send the log by sendDocument...")
+	resp, err := client.Post(telegramAPI(s.base, "sendDocument"), contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return telegramCheckResult(resp.StatusCode, respBody)
+}
+
+// buildDocument build the multipart form of sendDocument
+func (s *Telegram) buildDocument(caption string, log []byte) (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fields := [][2]string{
+		{"chat_id", s.base.viper.GetString("chat_id")},
+		{"caption", caption},
+	}
+	if threadID := s.base.viper.GetString("message_thread_id"); len(threadID) > 0 {
+		fields = append(fields, [2]string{"message_thread_id", threadID})
+	}
+	for _, field := range fields {
+		if err := w.WriteField(field[0], field[1]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	part, err := w.CreateFormFile("document", "vtsbackup.log")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(log); err != nil {
+		return nil, "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return &buf, w.FormDataContentType(), nil
 }
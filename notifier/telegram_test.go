@@ -16,8 +16,15 @@
 package notifier
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	"github.com/hantbk/vtsbackup/logger"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
@@ -51,3 +58,106 @@ func Test_Telegram(t *testing.T) {
 	err = s.checkResult(403, []byte(respBody))
 	assert.EqualError(t, err, "status: 403, body: "+respBody)
 }
+
+func Test_Telegram_format(t *testing.T) {
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(nil),
+	}
+	base.viper.Set("chat_id", "@backuptest")
+	base.viper.Set("message_thread_id", 42)
+	base.viper.Set("disable_notification", true)
+	base.viper.Set("parse_mode", "HTML")
+
+	s := NewTelegram(base)
+	body, err := s.buildBody("Backup <foo>", "a & b")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"chat_id":"@backuptest","text":"\u003cb\u003eBackup \u0026lt;foo\u0026gt;\u003c/b\u003e\n\na \u0026amp; b","parse_mode":"HTML",`+
+		`"message_thread_id":42,"disable_notification":true}`, string(body))
+
+	// The failure is not silent
+	base.result = newTestResult(errors.New("access denied"))
+	base.viper.Set("parse_mode", "MarkdownV2")
+	body, err = s.buildBody("[Backup] OK: foo", "Size: 2.0 MB (a_b.tar.gz)!")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"chat_id":"@backuptest","text":"*\\[Backup\\] OK: foo*\n\nSize: 2\\.0 MB \\(a\\_b\\.tar\\.gz\\)\\!","parse_mode":"MarkdownV2",`+
+		`"message_thread_id":42}`, string(body))
+
+	base.viper.Set("parse_mode", "Markdown")
+	_, err = s.buildBody("title", "message")
+	assert.EqualError(t, err, `invalid parse_mode "Markdown" for telegram notifier, must be HTML or MarkdownV2`)
+}
+
+func Test_Telegram_attachLog(t *testing.T) {
+	rr := newTestResult(errors.New("access denied"))
+	ctx, endLog := logger.WithRun(context.Background(), rr.ID)
+	defer endLog()
+	logger.TagContext(ctx, "Model: foo").Info("This is the log of the run")
+	logger.Info("This is the log of another model")
+
+	var mu sync.Mutex
+	var paths []string
+	var document, threadID string
+	documentFailed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+
+		if r.URL.Path == "/bottoken/sendDocument" {
+			if documentFailed {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			file, header, err := r.FormFile("document")
+			assert.NoError(t, err)
+			assert.Equal(t, "vtsbackup.log", header.Filename)
+			data, _ := io.ReadAll(file)
+			document = string(data)
+			threadID = r.FormValue("message_thread_id")
+		}
+	}))
+	defer server.Close()
+
+	base := &Base{
+		viper:  viper.New(),
+		result: newTestResult(nil),
+	}
+	base.viper.Set("endpoint", server.URL)
+	base.viper.Set("token", "token")
+	base.viper.Set("chat_id", "@backuptest")
+	base.viper.Set("message_thread_id", 42)
+	base.viper.Set("attach_log", true)
+
+	// The log is only attached on failure
+	s := NewTelegram(base)
+	assert.NoError(t, s.notify("This is title", "This is body"))
+
+	base.result = rr
+	assert.NoError(t, s.notify("This is title", "This is body"))
+
+	mu.Lock()
+	assert.Equal(t, []string{"/bottoken/sendMessage", "/bottoken/sendMessage", "/bottoken/sendDocument"}, paths)
+	assert.Contains(t, document, "This is the log of the run")
+	assert.NotContains(t, document, "This is the log of another model")
+	assert.Equal(t, "42", threadID)
+
+	// The message is sent even though the log is failed to send, so it's not queued again
+	paths = nil
+	documentFailed = true
+	mu.Unlock()
+	assert.NoError(t, s.notify("This is title", "This is body"))
+
+	// The log of the finished run is gone, e.g. the message is retried by the queue
+	endLog()
+	mu.Lock()
+	paths = nil
+	documentFailed = false
+	mu.Unlock()
+	assert.NoError(t, s.notify("This is title", "This is body"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/bottoken/sendMessage"}, paths)
+}
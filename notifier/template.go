@@ -0,0 +1,140 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
+)
+
+// templateData the data of `title_template` and `body_template`
+//
+//	title_template: "[{{ .Status }}] {{ .Model }} on {{ .Host }}"
+//	body_template: |
+//	  {{ .Message }}
+//	  {{ .LogTail 20 }}
+type templateData struct {
+	Model       string
+	Description string
+	Host        string
+	// Event of the notification, e.g. succeeded, failed, warning
+	Event string
+	// Status of the run: succeeded, failed, cancelled
+	Status string
+	// Title and Message the default title and message
+	Title   string
+	Message string
+	Error   string
+	Result  *result.RunResult
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// templateFuncs the functions of the templates, `json` is useful to build the JSON body
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"bytes": func(size int64) string {
+		return humanize.Bytes(uint64(size))
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+	"join": strings.Join,
+}
+
+func newTemplateData(model config.ModelConfig, rr *result.RunResult, title, message string) templateData {
+	host, _ := os.Hostname()
+
+	data := templateData{
+		Model:       model.Name,
+		Description: model.Description,
+		Host:        host,
+		Title:       title,
+		Message:     message,
+		Result:      rr,
+		FinishedAt:  time.Now(),
+	}
+
+	if rr != nil {
+		data.Status = rr.Status
+		data.Error = rr.Error
+		data.StartedAt = rr.StartedAt
+		data.FinishedAt = rr.FinishedAt
+	}
+
+	return data
+}
+
+// LogTail return the last n lines of the log of the run, empty when there is no run, e.g. the config reload
+func (d templateData) LogTail(n int) string {
+	if d.Result == nil {
+		return ""
+	}
+
+	return strings.Join(logger.RunTail(d.Result.ID, n), "\n")
+}
+
+// render the title and message by the templates, the default one is used when the template is not set or failed
+func (b *Base) render(data templateData) (title, message string) {
+	logger := logger.Tag(fmt.Sprintf("Notifier: %s", b.Name))
+
+	title, message = data.Title, data.Message
+
+	if len(b.titleTemplate) > 0 {
+		if s, err := renderTemplate("title_template", b.titleTemplate, data); err != nil {
+			logger.Errorf("Failed to render title_template, use the default title: %v", err)
+		} else {
+			title = s
+		}
+	}
+
+	if len(b.bodyTemplate) > 0 {
+		if s, err := renderTemplate("body_template", b.bodyTemplate, data); err != nil {
+			logger.Errorf("Failed to render body_template, use the default message: %v", err)
+		} else {
+			message = s
+		}
+	}
+
+	return
+}
+
+func renderTemplate(name, text string, data templateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,72 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	model := config.ModelConfig{Name: "foo", Description: "foo backup"}
+	rr := newTestResult(errors.New("upload failed"))
+	data := newTemplateData(model, rr, "Default title", "Default message")
+	assert.Equal(t, "failed", data.Status)
+	assert.Equal(t, "upload failed", data.Error)
+
+	// Default
+	base := &Base{Name: "webhook"}
+	title, message := base.render(data)
+	assert.Equal(t, "Default title", title)
+	assert.Equal(t, "Default message", message)
+
+	base.titleTemplate = "[{{ .Status }}] {{ .Model }} - {{ .Description }}"
+	base.bodyTemplate = `{"model":{{ json .Model }},"error":{{ json .Error }},"size":"{{ bytes .Result.ArchiveSize }}","duration":"{{ duration .Result.Duration }}","started_at":"{{ .StartedAt.Format "2006-01-02" }}"}`
+	title, message = base.render(data)
+	assert.Equal(t, "[failed] foo - foo backup", title)
+	assert.Equal(t, `{"model":"foo","error":"upload failed","size":"2.0 MB","duration":"1m30s","started_at":"2024-05-01"}`, message)
+
+	// Fallback to the default when the template is invalid
+	base.titleTemplate = "{{ .Status "
+	base.bodyTemplate = "{{ .NotExists }}"
+	title, message = base.render(data)
+	assert.Equal(t, "Default title", title)
+	assert.Equal(t, "Default message", message)
+}
+
+func TestTemplateData_LogTail(t *testing.T) {
+	rr := newTestResult(errors.New("upload failed"))
+	ctx, end := logger.WithRun(context.Background(), rr.ID)
+	defer end()
+	otherCtx, otherEnd := logger.WithRun(context.Background(), "other")
+	defer otherEnd()
+
+	logger.TagContext(ctx, "Storage").Error("upload failed")
+	logger.TagContext(otherCtx, "Storage").Info("upload of other model")
+
+	data := newTemplateData(config.ModelConfig{Name: "foo"}, rr, "title", "message")
+	tail := data.LogTail(10)
+	assert.Contains(t, tail, "upload failed")
+	assert.NotContains(t, tail, "other model")
+
+	data = newTemplateData(config.ModelConfig{Name: "foo"}, nil, "title", "message")
+	assert.Empty(t, data.LogTail(10))
+}
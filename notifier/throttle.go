@@ -0,0 +1,165 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/result"
+)
+
+var (
+	// notifyStatePath the last sent notifications, it's kept across restarts for `min_interval`, `on_change` and `digest`
+	notifyStatePath = filepath.Join(config.VtsBackupDir, "notify_state.json")
+	notifyStateMu   sync.Mutex
+)
+
+// notifyState of a notifier of the model
+type notifyState struct {
+	LastSentAt time.Time `json:"last_sent_at,omitempty"`
+	// LastStatus the status of the run in the last sent notification
+	LastStatus   string    `json:"last_status,omitempty"`
+	LastDigestAt time.Time `json:"last_digest_at,omitempty"`
+}
+
+func notifyStateKey(model, name string) string {
+	return model + "/" + name
+}
+
+func loadNotifyStates() (map[string]notifyState, error) {
+	states := map[string]notifyState{}
+
+	data, err := os.ReadFile(notifyStatePath)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return states, err
+	}
+
+	if err := json.Unmarshal(data, &states); err != nil {
+		return states, fmt.Errorf("invalid notify state %s: %v", notifyStatePath, err)
+	}
+
+	return states, nil
+}
+
+func getNotifyState(model, name string) notifyState {
+	notifyStateMu.Lock()
+	defer notifyStateMu.Unlock()
+
+	states, _ := loadNotifyStates()
+	return states[notifyStateKey(model, name)]
+}
+
+// lockNotifyState hold the lock of the state across the processes, e.g. `vtsbackup perform` and the daemon
+func lockNotifyState() (unlock func(), err error) {
+	if err := helper.MkdirP(filepath.Dir(notifyStatePath)); err != nil {
+		return nil, err
+	}
+
+	lockPath := notifyStatePath + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %s: %v", lockPath, err)
+	}
+
+	if err := helper.LockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %v", lockPath, err)
+	}
+
+	return func() {
+		helper.UnlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// updateNotifyState update the state of the notifier and save it
+func updateNotifyState(model, name string, update func(state *notifyState)) error {
+	notifyStateMu.Lock()
+	defer notifyStateMu.Unlock()
+
+	unlock, err := lockNotifyState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	states, err := loadNotifyStates()
+	if err != nil {
+		return err
+	}
+
+	key := notifyStateKey(model, name)
+	state := states[key]
+	update(&state)
+	states[key] = state
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file at once, the readers without the lock never see a partial file
+	tmpPath := notifyStatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, notifyStatePath)
+}
+
+// throttled check the notification of the run should be skipped by `on_change` and `min_interval`,
+// the reason is returned when it's skipped.
+// A changed status is always sent, so the recovery is not hidden by `min_interval`.
+func (b *Base) throttled(model string, rr *result.RunResult, now time.Time) (bool, string) {
+	if !b.onChange && b.minInterval <= 0 {
+		return false, ""
+	}
+
+	state := getNotifyState(model, b.Name)
+	if rr == nil || rr.Status != state.LastStatus {
+		return false, ""
+	}
+
+	if b.onChange {
+		return true, fmt.Sprintf("status is still %s", rr.Status)
+	}
+
+	if next := state.LastSentAt.Add(b.minInterval); now.Before(next) {
+		return true, fmt.Sprintf("min_interval %s, next at %s", b.minInterval, next.Format(time.RFC3339))
+	}
+
+	return false, ""
+}
+
+// markSent record the notification of the run is sent
+func (b *Base) markSent(model string, rr *result.RunResult, now time.Time) error {
+	return updateNotifyState(model, b.Name, func(state *notifyState) {
+		state.LastSentAt = now
+		if rr != nil {
+			state.LastStatus = rr.Status
+		}
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notifier
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottled(t *testing.T) {
+	notifyStatePath = filepath.Join(t.TempDir(), "notify_state.json")
+
+	now := time.Now()
+	failed := newTestResult(errors.New("upload failed"))
+	succeeded := newTestResult(nil)
+
+	// Not throttled
+	base := &Base{Name: "telegram"}
+	skip, _ := base.throttled("foo", failed, now)
+	assert.False(t, skip)
+
+	// on_change
+	base = &Base{Name: "slack", onChange: true}
+	skip, _ = base.throttled("foo", failed, now)
+	assert.False(t, skip)
+	assert.NoError(t, base.markSent("foo", failed, now))
+	skip, reason := base.throttled("foo", failed, now.Add(time.Hour))
+	assert.True(t, skip)
+	assert.Equal(t, "status is still failed", reason)
+	skip, _ = base.throttled("foo", succeeded, now.Add(time.Hour))
+	assert.False(t, skip)
+	// Other models are not affected
+	skip, _ = base.throttled("bar", failed, now)
+	assert.False(t, skip)
+
+	// min_interval
+	base = &Base{Name: "mail", minInterval: time.Hour}
+	assert.NoError(t, base.markSent("foo", failed, now))
+	skip, _ = base.throttled("foo", failed, now.Add(30*time.Minute))
+	assert.True(t, skip)
+	skip, _ = base.throttled("foo", failed, now.Add(time.Hour))
+	assert.False(t, skip)
+	// The recovery is always sent
+	skip, _ = base.throttled("foo", succeeded, now.Add(time.Minute))
+	assert.False(t, skip)
+
+	state := getNotifyState("foo", "mail")
+	assert.Equal(t, "failed", state.LastStatus)
+	assert.True(t, now.Equal(state.LastSentAt))
+}
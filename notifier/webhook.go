@@ -16,15 +16,33 @@
 package notifier
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hantbk/vtsbackup/logger"
 )
 
+// Headers of the signed webhook request
+const (
+	webhookTimestampHeader = "X-Backup-Timestamp"
+	webhookSignatureHeader = "X-Backup-Signature"
+)
+
+// defaultWebhookTimeout the timeout of the request, include reading the response body
+const defaultWebhookTimeout = 30 * time.Second
+
 type Webhook struct {
 	Base
 
@@ -36,6 +54,8 @@ type Webhook struct {
 	buildWebhookURL func(url string) (string, error)
 	checkResult     func(status int, responseBody []byte) error
 	buildHeaders    func() map[string]string
+	// signBody return the headers of the signature of the body, nil is not signed
+	signBody func(body []byte, now time.Time) map[string]string
 }
 
 type webhookPayload struct {
@@ -43,15 +63,35 @@ type webhookPayload struct {
 	Message string `json:"message"`
 }
 
+// NewWebhook send the title and message as JSON, or the body rendered by `body_template`
+//
+// type: webhook
+// url: https://example.com/hook
+// method: POST
+// bearer_token: xxxx
+// username: ...
+// password: ...
+// secret: the-shared-secret
+// timeout: 30s
+// ca_file: /path/to/ca.pem
+// cert_file: /path/to/client.pem
+// key_file: /path/to/client-key.pem
+// insecure_skip_verify: false
 func NewWebhook(base *Base) *Webhook {
 	base.viper.SetDefault("method", "POST")
+	base.viper.SetDefault("content_type", "application/json")
 
 	return &Webhook{
 		Base:        *base,
 		Service:     "Webhook",
 		method:      base.viper.GetString("method"),
-		contentType: "application/json",
+		contentType: base.viper.GetString("content_type"),
 		buildBody: func(title, message string) ([]byte, error) {
+			// The message is rendered by `body_template` as the whole body, e.g. JSON of any receiving system
+			if len(base.bodyTemplate) > 0 {
+				return []byte(message), nil
+			}
+
 			return json.Marshal(webhookPayload{
 				Title:   title,
 				Message: message,
@@ -59,14 +99,35 @@ func NewWebhook(base *Base) *Webhook {
 		},
 		buildHeaders: func() map[string]string {
 			headers := make(map[string]string)
+			if token := base.viper.GetString("bearer_token"); len(token) > 0 {
+				headers["Authorization"] = "Bearer " + token
+			} else if username := base.viper.GetString("username"); len(username) > 0 {
+				credentials := username + ":" + base.viper.GetString("password")
+				headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+			}
+
+			// The static headers are able to override the auth
 			for key, value := range base.viper.GetStringMapString("headers") {
 				headers[key] = value
 			}
 
 			return headers
 		},
+		signBody: func(body []byte, now time.Time) map[string]string {
+			secret := base.viper.GetString("secret")
+			if len(secret) == 0 {
+				return nil
+			}
+
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			return map[string]string{
+				webhookTimestampHeader: timestamp,
+				webhookSignatureHeader: "sha256=" + webhookSignature(secret, timestamp, body),
+			}
+		},
 		checkResult: func(status int, responseBody []byte) error {
-			if status == 200 {
+			// Any 2xx, e.g. 201 Created, 202 Accepted, 204 No Content
+			if status >= 200 && status < 300 {
 				return nil
 			}
 
@@ -75,6 +136,51 @@ func NewWebhook(base *Base) *Webhook {
 	}
 }
 
+// webhookSignature the HMAC-SHA256 of `{timestamp}.{body}` in hex, the timestamp is signed to prevent the replay
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// httpClient return the client with `timeout` and the TLS options: `ca_file`, `cert_file`, `key_file` and `insecure_skip_verify`
+func (s *Webhook) httpClient() (*http.Client, error) {
+	timeout := defaultWebhookTimeout
+	if s.viper.IsSet("timeout") {
+		timeout = s.viper.GetDuration("timeout")
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: s.viper.GetBool("insecure_skip_verify"),
+	}
+
+	if caFile := s.viper.GetString("ca_file"); len(caFile) > 0 {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %v", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca_file %s", caFile)
+		}
+	}
+
+	if certFile := s.viper.GetString("cert_file"); len(certFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, s.viper.GetString("key_file"))
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
 func (s *Webhook) getLogger() logger.Logger {
 	return logger.Tag(fmt.Sprintf("Notifier: %s", s.Service))
 }
@@ -118,7 +224,16 @@ func (s *Webhook) notify(title string, message string) error {
 		}
 	}
 
-	client := &http.Client{}
+	if s.signBody != nil {
+		for key, value := range s.signBody(payload, time.Now()) {
+			req.Header.Set(key, value)
+		}
+	}
+
+	client, err := s.httpClient()
+	if err != nil {
+		return err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error(err)
@@ -137,8 +252,7 @@ func (s *Webhook) notify(title string, message string) error {
 	if s.checkResult != nil {
 		err = s.checkResult(resp.StatusCode, body)
 		if err != nil {
-			logger.Error(err)
-			return nil
+			return err
 		}
 	} else {
 		logger.Infof("Response body: %s", string(body))
@@ -16,7 +16,17 @@
 package notifier
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -47,6 +57,15 @@ func Test_Webhook(t *testing.T) {
 	headers := s.buildHeaders()
 	assert.Equal(t, "Bearer this-is-token", headers["Authorization"])
 
+	// body_template
+	base.viper.Set("content_type", "application/x-www-form-urlencoded")
+	base.bodyTemplate = "text={{ .Title }}"
+	s = NewWebhook(base)
+	assert.Equal(t, "application/x-www-form-urlencoded", s.contentType)
+	body, err = s.buildBody("This is title", "text=This is title")
+	assert.NoError(t, err)
+	assert.Equal(t, "text=This is title", string(body))
+
 	err = s.checkResult(200, []byte(`{"status":"ok"}`))
 	assert.NoError(t, err)
 
@@ -54,3 +73,115 @@ func Test_Webhook(t *testing.T) {
 	err = s.checkResult(403, []byte(respBody))
 	assert.EqualError(t, err, "status: 403, body: "+respBody)
 }
+
+func Test_Webhook_Auth(t *testing.T) {
+	base := &Base{
+		viper: viper.New(),
+	}
+
+	base.viper.Set("username", "backup")
+	base.viper.Set("password", "secret")
+	s := NewWebhook(base)
+	assert.Equal(t, "Basic YmFja3VwOnNlY3JldA==", s.buildHeaders()["Authorization"])
+
+	base.viper.Set("bearer_token", "this-is-token")
+	s = NewWebhook(base)
+	assert.Equal(t, "Bearer this-is-token", s.buildHeaders()["Authorization"])
+
+	// The static headers override the auth
+	base.viper.Set("headers", map[string]string{"Authorization": "Token other"})
+	s = NewWebhook(base)
+	assert.Equal(t, "Token other", s.buildHeaders()["Authorization"])
+}
+
+func Test_Webhook_Sign(t *testing.T) {
+	base := &Base{
+		viper: viper.New(),
+	}
+
+	s := NewWebhook(base)
+	assert.Nil(t, s.signBody([]byte("{}"), time.Now()))
+
+	base.viper.Set("secret", "the-shared-secret")
+	s = NewWebhook(base)
+	headers := s.signBody([]byte(`{"title":"foo"}`), time.Unix(1714521690, 0))
+	assert.Equal(t, "1714521690", headers["X-Backup-Timestamp"])
+
+	mac := hmac.New(sha256.New, []byte("the-shared-secret"))
+	mac.Write([]byte(`1714521690.{"title":"foo"}`))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), headers["X-Backup-Signature"])
+}
+
+func Test_Webhook_checkResult(t *testing.T) {
+	s := NewWebhook(&Base{viper: viper.New()})
+
+	assert.NoError(t, s.checkResult(201, nil))
+	assert.NoError(t, s.checkResult(202, nil))
+	assert.NoError(t, s.checkResult(204, nil))
+	assert.EqualError(t, s.checkResult(302, nil), "status: 302, body: ")
+	assert.EqualError(t, s.checkResult(500, []byte("oops")), "status: 500, body: oops")
+}
+
+func Test_Webhook_notify(t *testing.T) {
+	var received http.Header
+	var receivedBody []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	base := &Base{
+		viper: viper.New(),
+	}
+	base.viper.Set("url", server.URL)
+	base.viper.Set("secret", "the-shared-secret")
+
+	// The certificate of the server is untrusted
+	err := NewWebhook(base).notify("This is title", "This is body")
+	assert.ErrorContains(t, err, "certificate")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, caPEM, 0o644))
+	base.viper.Set("ca_file", caFile)
+
+	err = NewWebhook(base).notify("This is title", "This is body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"This is title","message":"This is body"}`, string(receivedBody))
+
+	timestamp := received.Get("X-Backup-Timestamp")
+	assert.NotEmpty(t, timestamp)
+	assert.Equal(t, "sha256="+webhookSignature("the-shared-secret", timestamp, receivedBody), received.Get("X-Backup-Signature"))
+
+	base.viper.Set("ca_file", filepath.Join(t.TempDir(), "missing.pem"))
+	err = NewWebhook(base).notify("This is title", "This is body")
+	assert.ErrorContains(t, err, "read ca_file")
+}
+
+func Test_Webhook_timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	base := &Base{
+		viper: viper.New(),
+	}
+	base.viper.Set("url", server.URL)
+	base.viper.Set("timeout", "100ms")
+
+	client, err := NewWebhook(base).httpClient()
+	assert.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, client.Timeout)
+
+	err = NewWebhook(base).notify("This is title", "This is body")
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+
+	client, err = NewWebhook(&Base{viper: viper.New()}).httpClient()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, client.Timeout)
+}
@@ -0,0 +1,204 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package result
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hantbk/vtsbackup/jobs"
+)
+
+// RunResult of a model run, it's built up by the pipeline stages
+type RunResult struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Trigger string `json:"trigger,omitempty"`
+	// Attempt of the run when it's retried, starts from 1
+	Attempt    int           `json:"attempt,omitempty"`
+	Status     string        `json:"status"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration"`
+	Stages     []Stage       `json:"stages,omitempty"`
+	// ArchivePath the final archive after compressing and encrypting
+	ArchivePath string `json:"archive_path,omitempty"`
+	ArchiveSize int64  `json:"archive_size"`
+	// Files the chunks of the archive when it's split
+	Files        []string      `json:"files,omitempty"`
+	SkippedFiles []SkippedFile `json:"skipped_files,omitempty"`
+	Storages     []Storage     `json:"storages,omitempty"`
+	// Pruned the old backups removed by `keep`
+	Pruned []Pruned `json:"pruned,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Stage timing of the pipeline
+type Stage struct {
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// SkippedFile the file can't be read by archive
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Storage the outcome of a storage
+type Storage struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Pruned the old backups removed from a storage
+type Pruned struct {
+	Storage string   `json:"storage"`
+	Keys    []string `json:"keys"`
+}
+
+// New start a run result of the model
+func New(id, model, trigger string) *RunResult {
+	return &RunResult{
+		ID:        id,
+		Model:     model,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+	}
+}
+
+// StartStage finish the current stage and start a new one
+func (r *RunResult) StartStage(name string) {
+	now := time.Now()
+	r.finishStage(now)
+	r.Stages = append(r.Stages, Stage{Name: name, StartedAt: now})
+}
+
+func (r *RunResult) finishStage(now time.Time) {
+	if n := len(r.Stages); n > 0 && r.Stages[n-1].Duration == 0 {
+		r.Stages[n-1].Duration = now.Sub(r.Stages[n-1].StartedAt)
+	}
+}
+
+// SetArchive set the archive path and size
+func (r *RunResult) SetArchive(archivePath string) {
+	r.ArchivePath = archivePath
+	if info, err := os.Stat(archivePath); err == nil {
+		r.ArchiveSize = info.Size()
+	}
+}
+
+// AddSkippedFile add the file skipped by archive
+func (r *RunResult) AddSkippedFile(path, reason string) {
+	r.SkippedFiles = append(r.SkippedFiles, SkippedFile{Path: path, Reason: reason})
+}
+
+// AddStorage add the outcome of a storage
+func (r *RunResult) AddStorage(name, storageType string, duration time.Duration, err error) {
+	storage := Storage{Name: name, Type: storageType, Duration: duration}
+	if err != nil {
+		storage.Error = err.Error()
+	}
+	r.Storages = append(r.Storages, storage)
+}
+
+// AddPruned add the old backups removed from the storage
+func (r *RunResult) AddPruned(storage string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	r.Pruned = append(r.Pruned, Pruned{Storage: storage, Keys: keys})
+}
+
+// Warnings of the run, e.g. the files are skipped, or some of the storages are failed while the others are succeeded
+func (r *RunResult) Warnings() (warnings []string) {
+	if len(r.SkippedFiles) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d files skipped", len(r.SkippedFiles)))
+	}
+
+	failed := 0
+	for _, storage := range r.Storages {
+		if len(storage.Error) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 && failed < len(r.Storages) {
+		warnings = append(warnings, fmt.Sprintf("%d of %d storages failed", failed, len(r.Storages)))
+	}
+
+	return warnings
+}
+
+// Finish the run result with the error
+func (r *RunResult) Finish(err error, cancelled bool) {
+	r.FinishedAt = time.Now()
+	r.finishStage(r.FinishedAt)
+	r.Duration = r.FinishedAt.Sub(r.StartedAt)
+
+	switch {
+	case err == nil:
+		r.Status = string(jobs.StateSucceeded)
+	case cancelled:
+		r.Status = string(jobs.StateCancelled)
+	default:
+		r.Status = string(jobs.StateFailed)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Summary the statistics for the notification message
+func (r *RunResult) Summary() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Duration: %s\n", r.Duration.Round(time.Millisecond))
+	if r.Attempt > 0 {
+		fmt.Fprintf(&sb, "Attempt: %d\n", r.Attempt)
+	}
+	if r.ArchiveSize > 0 {
+		fmt.Fprintf(&sb, "Archive size: %s\n", humanize.Bytes(uint64(r.ArchiveSize)))
+	}
+	if len(r.Files) > 0 {
+		fmt.Fprintf(&sb, "Chunks: %d\n", len(r.Files))
+	}
+
+	if len(r.Storages) > 0 {
+		sb.WriteString("Storages:\n")
+		for _, storage := range r.Storages {
+			if len(storage.Error) > 0 {
+				fmt.Fprintf(&sb, "- %s (%s): failed, %s\n", storage.Name, storage.Type, storage.Error)
+			} else {
+				fmt.Fprintf(&sb, "- %s (%s): succeeded in %s\n", storage.Name, storage.Type, storage.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+
+	if len(r.SkippedFiles) > 0 {
+		fmt.Fprintf(&sb, "Skipped files (%d):\n", len(r.SkippedFiles))
+		for _, file := range r.SkippedFiles {
+			fmt.Fprintf(&sb, "- %s: %s\n", file.Path, file.Reason)
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,109 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package result
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResult(t *testing.T) {
+	rr := New("abc", "foo", "cli")
+	rr.StartStage("compress")
+	time.Sleep(10 * time.Millisecond)
+	rr.StartStage("storage")
+	rr.AddStorage("s3", "s3", time.Second, nil)
+	rr.AddStorage("ftp", "ftp", 2*time.Second, errors.New("connection refused"))
+	rr.Finish(errors.New("Storage errors: [connection refused]"), false)
+
+	assert.Equal(t, "failed", rr.Status)
+	assert.Equal(t, "Storage errors: [connection refused]", rr.Error)
+	assert.Len(t, rr.Stages, 2)
+	assert.GreaterOrEqual(t, rr.Stages[0].Duration, 10*time.Millisecond)
+	assert.NotZero(t, rr.Stages[1].Duration)
+	assert.Equal(t, []Storage{
+		{Name: "s3", Type: "s3", Duration: time.Second},
+		{Name: "ftp", Type: "ftp", Duration: 2 * time.Second, Error: "connection refused"},
+	}, rr.Storages)
+
+	rr = New("abc", "foo", "cli")
+	rr.Finish(nil, false)
+	assert.Equal(t, "succeeded", rr.Status)
+	assert.Empty(t, rr.Error)
+
+	rr = New("abc", "foo", "cli")
+	rr.Finish(context.Canceled, true)
+	assert.Equal(t, "cancelled", rr.Status)
+}
+
+func TestRunResult_Warnings(t *testing.T) {
+	rr := New("abc", "foo", "cli")
+	assert.Empty(t, rr.Warnings())
+
+	rr.AddStorage("s3", "s3", time.Second, errors.New("access denied"))
+	assert.Empty(t, rr.Warnings())
+
+	rr.AddStorage("ftp", "ftp", time.Second, nil)
+	rr.AddSkippedFile("/etc/shadow", "Cannot open: Permission denied")
+	assert.Equal(t, []string{"1 files skipped", "1 of 2 storages failed"}, rr.Warnings())
+
+	rr.AddPruned("s3", nil)
+	assert.Empty(t, rr.Pruned)
+	rr.AddPruned("s3", []string{"foo.tar.gz"})
+	assert.Equal(t, []Pruned{{Storage: "s3", Keys: []string{"foo.tar.gz"}}}, rr.Pruned)
+}
+
+func TestRunResult_SetArchive(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "foo.tar.gz")
+	assert.NoError(t, os.WriteFile(archivePath, make([]byte, 2048), 0644))
+
+	rr := New("abc", "foo", "")
+	rr.SetArchive(archivePath)
+	assert.Equal(t, archivePath, rr.ArchivePath)
+	assert.Equal(t, int64(2048), rr.ArchiveSize)
+}
+
+func TestRunResult_Summary(t *testing.T) {
+	rr := &RunResult{
+		Duration:    90 * time.Second,
+		ArchiveSize: 2 * 1000 * 1000,
+		Files:       []string{"foo.tar.gz-000", "foo.tar.gz-001"},
+	}
+	rr.AddStorage("s3", "s3", 1500*time.Millisecond, nil)
+	rr.AddStorage("ftp", "ftp", time.Second, errors.New("connection refused"))
+	rr.AddSkippedFile("/etc/shadow", "Cannot open: Permission denied")
+
+	assert.Equal(t, `Duration: 1m30s
+Archive size: 2.0 MB
+Chunks: 2
+Storages:
+- s3 (s3): succeeded in 1.5s
+- ftp (ftp): failed, connection refused
+Skipped files (1):
+- /etc/shadow: Cannot open: Permission denied`, rr.Summary())
+
+	rr = &RunResult{Duration: time.Second}
+	assert.Equal(t, "Duration: 1s", rr.Summary())
+
+	rr.Attempt = 2
+	assert.Equal(t, "Duration: 1s\nAttempt: 2", rr.Summary())
+}
@@ -0,0 +1,121 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/jobs"
+	superlogger "github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/model"
+)
+
+// chain run the models in the order of `depends_on` and `trigger_after`,
+// each model runs at most once in a chain.
+type chain struct {
+	// ctx is cancelled when the scheduler is stopped, the models are not started after it
+	ctx     context.Context
+	trigger string
+	// results of the models in the chain
+	results map[string]error
+
+	perform func(modelConfig config.ModelConfig, trigger string) error
+	fail    func(modelConfig config.ModelConfig, trigger string, reason error)
+}
+
+func newChain(ctx context.Context, trigger string) *chain {
+	return &chain{
+		ctx:     ctx,
+		trigger: trigger,
+		results: map[string]error{},
+		perform: func(modelConfig config.ModelConfig, trigger string) error {
+			return runModel(ctx, modelConfig, trigger)
+		},
+		fail: failModel,
+	}
+}
+
+// run the models in `depends_on` first, then the model, then the models `trigger_after` it
+func (c *chain) run(modelConfig config.ModelConfig) error {
+	if err, ok := c.results[modelConfig.Name]; ok {
+		return err
+	}
+
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := pausedError(modelConfig.Name, time.Now()); err != nil {
+		superlogger.Tag(fmt.Sprintf("Scheduler: %s", modelConfig.Name)).Warnf("Skipped: %v", err)
+		c.results[modelConfig.Name] = err
+		return err
+	}
+
+	for _, name := range modelConfig.DependsOn {
+		upstream := config.GetModelConfigByName(name)
+		if upstream == nil {
+			return c.upstreamFailed(modelConfig, fmt.Errorf("upstream model %s not found", name))
+		}
+
+		if err := c.run(*upstream); err != nil {
+			return c.upstreamFailed(modelConfig, fmt.Errorf("upstream model %s failed: %v", name, err))
+		}
+	}
+
+	err := c.perform(modelConfig, c.trigger)
+	c.results[modelConfig.Name] = err
+
+	for _, downstream := range config.TriggeredAfter(modelConfig.Name) {
+		if _, ok := c.results[downstream.Name]; ok {
+			continue
+		}
+
+		if err != nil {
+			c.upstreamFailed(downstream, fmt.Errorf("upstream model %s failed: %v", modelConfig.Name, err))
+			continue
+		}
+
+		_ = c.run(downstream)
+	}
+
+	return err
+}
+
+// upstreamFailed skip or fail the model by `upstream_failure`
+func (c *chain) upstreamFailed(modelConfig config.ModelConfig, reason error) error {
+	logger := superlogger.Tag(fmt.Sprintf("Scheduler: %s", modelConfig.Name))
+
+	c.results[modelConfig.Name] = reason
+	if modelConfig.UpstreamFailure == config.UpstreamFailureFail {
+		logger.Errorf("Failed: %v", reason)
+		c.fail(modelConfig, c.trigger, reason)
+	} else {
+		logger.Warnf("Skipped: %v", reason)
+	}
+
+	return reason
+}
+
+// failModel report the model as failed, it's recorded in history and notified
+func failModel(modelConfig config.ModelConfig, trigger string, reason error) {
+	m := model.Model{
+		Config: modelConfig,
+	}
+	m.Fail(jobs.WithTrigger(context.Background(), trigger), reason)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupChainTest(t *testing.T, models []config.ModelConfig, failed map[string]bool) (c *chain, performed *[]string, reported *[]string) {
+	t.Helper()
+
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+
+	oldModels := config.Models
+	config.Models = models
+	t.Cleanup(func() { config.Models = oldModels })
+
+	performed = &[]string{}
+	reported = &[]string{}
+	c = newChain(context.Background(), "schedule")
+	c.perform = func(modelConfig config.ModelConfig, trigger string) error {
+		*performed = append(*performed, modelConfig.Name)
+		if failed[modelConfig.Name] {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	c.fail = func(modelConfig config.ModelConfig, trigger string, reason error) {
+		*reported = append(*reported, modelConfig.Name+": "+reason.Error())
+	}
+
+	return
+}
+
+func TestChain_run(t *testing.T) {
+	models := []config.ModelConfig{
+		{Name: "db"},
+		{Name: "app", DependsOn: []string{"db"}},
+		{Name: "replicate", TriggerAfter: []string{"app"}},
+		{Name: "verify", DependsOn: []string{"app"}, TriggerAfter: []string{"app"}},
+	}
+	c, performed, reported := setupChainTest(t, models, nil)
+
+	assert.NoError(t, c.run(models[1]))
+	assert.Equal(t, []string{"db", "app", "replicate", "verify"}, *performed)
+	assert.Empty(t, *reported)
+}
+
+func TestChain_upstreamFailed(t *testing.T) {
+	models := []config.ModelConfig{
+		{Name: "db"},
+		{Name: "app", DependsOn: []string{"db"}, UpstreamFailure: config.UpstreamFailureFail},
+		{Name: "replicate", TriggerAfter: []string{"app"}, UpstreamFailure: config.UpstreamFailureSkip},
+	}
+	c, performed, reported := setupChainTest(t, models, map[string]bool{"db": true})
+
+	assert.EqualError(t, c.run(models[1]), "upstream model db failed: boom")
+	assert.Equal(t, []string{"db"}, *performed)
+	assert.Equal(t, []string{"app: upstream model db failed: boom"}, *reported)
+
+	c, performed, reported = setupChainTest(t, models, map[string]bool{"app": true})
+
+	assert.EqualError(t, c.run(models[1]), "boom")
+	assert.Equal(t, []string{"db", "app"}, *performed)
+	assert.Empty(t, *reported)
+	assert.EqualError(t, c.results["replicate"], "upstream model app failed: boom")
+}
+
+func TestChain_paused(t *testing.T) {
+	models := []config.ModelConfig{
+		{Name: "db"},
+		{Name: "app", TriggerAfter: []string{"db"}},
+	}
+	c, performed, _ := setupChainTest(t, models, nil)
+
+	until := time.Now().Add(time.Hour)
+	assert.NoError(t, Pause("db", until))
+	assert.EqualError(t, c.run(models[0]), "model db is paused until "+until.Format(time.RFC3339))
+	assert.Empty(t, *performed)
+
+	c, performed, _ = setupChainTest(t, models, nil)
+	assert.NoError(t, Pause("db", time.Time{}))
+	assert.NoError(t, Resume("db"))
+	assert.NoError(t, c.run(models[0]))
+	assert.Equal(t, []string{"db", "app"}, *performed)
+}
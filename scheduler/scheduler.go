@@ -16,19 +16,34 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-co-op/gocron"
 	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/jobs"
 	superlogger "github.com/hantbk/vtsbackup/logger"
 	"github.com/hantbk/vtsbackup/model"
+	"github.com/hantbk/vtsbackup/notifier"
+	"github.com/hantbk/vtsbackup/result"
 )
 
 var (
-	mycron *gocron.Scheduler
+	// mycrons the schedulers of each timezone
+	mycrons = map[string]*gocron.Scheduler{}
+	// cronJobs the registered jobs of the models
+	cronJobs = map[string]*gocron.Job{}
+	cronMu   sync.Mutex
+	// stopRuns cancel the delays and retries of the runs started by the scheduler, they are stale after the restart
+	stopRuns context.CancelFunc
+
+	// notifyQueueInterval how often the queue of the failed notifications is checked
+	notifyQueueInterval = 30 * time.Second
 )
 
 func init() {
@@ -41,9 +56,20 @@ func init() {
 func Start() error {
 	logger := superlogger.Tag("Scheduler")
 
-	mycron = gocron.NewScheduler(time.Local)
+	cronMu.Lock()
+	defer cronMu.Unlock()
+
+	mycrons = map[string]*gocron.Scheduler{}
+	cronJobs = map[string]*gocron.Job{}
+
+	var ctx context.Context
+	ctx, stopRuns = context.WithCancel(context.Background())
 
-	mu := sync.Mutex{}
+	states, err := loadStates()
+	if err != nil {
+		logger.Errorf("Failed to load schedule state: %v", err)
+	}
+	now := time.Now()
 
 	for _, modelConfig := range config.Models {
 		if !modelConfig.Schedule.Enabled {
@@ -52,6 +78,24 @@ func Start() error {
 
 		logger.Info(fmt.Sprintf("Register %s with (%s)", modelConfig.Name, modelConfig.Schedule.String()))
 
+		lastRun := states[modelConfig.Name].LastRunAt
+		missed, catchUp := catchUpRun(modelConfig.Schedule, lastRun, now)
+		if catchUp {
+			logger.Infof("Catch up %s missed run at %s", modelConfig.Name, missed.Format(time.RFC3339))
+		} else if !missed.IsZero() {
+			logger.Warnf("Missed run of %s at %s", modelConfig.Name, missed.Format(time.RFC3339))
+		}
+
+		location := modelConfig.Schedule.Location
+		if location == nil {
+			location = time.Local
+		}
+		mycron, ok := mycrons[location.String()]
+		if !ok {
+			mycron = gocron.NewScheduler(location)
+			mycrons[location.String()] = mycron
+		}
+
 		var scheduler *gocron.Scheduler
 		if modelConfig.Schedule.Cron != "" {
 			scheduler = mycron.Cron(modelConfig.Schedule.Cron)
@@ -60,34 +104,244 @@ func Start() error {
 			if len(modelConfig.Schedule.At) > 0 {
 				scheduler = scheduler.At(modelConfig.Schedule.At)
 			} else {
-				// If no $at present, delay start cron job with $eveny duration
+				// If no $at present, delay start cron job with $eveny duration after the last run,
+				// so the timer is not restarted by the process start
 				startDuration, _ := time.ParseDuration(modelConfig.Schedule.Every)
-				scheduler = scheduler.StartAt(time.Now().Add(startDuration))
+				startAt := now.Add(startDuration)
+				if next, err := nextRunAfter(modelConfig.Schedule, lastRun); err == nil && !catchUp && next.After(now) {
+					startAt = next
+				}
+				scheduler = scheduler.StartAt(startAt)
 			}
 		}
 
-		if _, err := scheduler.Do(func(modelConfig config.ModelConfig) {
-			defer mu.Unlock()
-			logger := superlogger.Tag(fmt.Sprintf("Scheduler: %s", modelConfig.Name))
+		job, err := scheduler.Do(perform, ctx, modelConfig, jobs.TriggerSchedule)
+		if err != nil {
+			logger.Errorf("Failed to register job func: %s", err.Error())
+			continue
+		}
+		cronJobs[modelConfig.Name] = job
+
+		if catchUp {
+			go perform(ctx, modelConfig, jobs.TriggerCatchUp)
+		}
+	}
+
+	localCron := func() *gocron.Scheduler {
+		mycron, ok := mycrons[time.Local.String()]
+		if !ok {
+			mycron = gocron.NewScheduler(time.Local)
+			mycrons[time.Local.String()] = mycron
+		}
+		return mycron
+	}
+
+	if config.NotifyQueue.Enabled {
+		if _, err := localCron().Every(notifyQueueInterval).Do(retryNotifyQueue); err != nil {
+			logger.Errorf("Failed to register the notify queue: %v", err)
+		}
+	}
+
+	// The digests of the notifiers, including the models are not scheduled
+	for _, group := range notifier.Digests(config.Models) {
+		logger.Infof("Register digest of %d models to %s at %s", len(group.Models), group.Notifier, group.At)
+		if _, err := localCron().Every(1).Day().At(group.At).Do(notifier.Digest, group); err != nil {
+			logger.Errorf("Failed to register digest to %s: %v", group.Notifier, err)
+		}
+	}
+
+	for _, mycron := range mycrons {
+		mycron.StartAsync()
+	}
+
+	return nil
+}
+
+// retryNotifyQueue send the due notifications in the queue
+func retryNotifyQueue() {
+	if _, err := notifier.RetryQueue(false); err != nil {
+		superlogger.Tag("Scheduler").Errorf("Failed to retry the notify queue: %v", err)
+	}
+}
+
+// perform the model and the chain of it, ctx is cancelled when the scheduler is stopped
+func perform(ctx context.Context, modelConfig config.ModelConfig, trigger string) {
+	logger := superlogger.Tag(fmt.Sprintf("Scheduler: %s", modelConfig.Name))
+
+	if delay := startDelay(modelConfig.Schedule, time.Now()); delay > 0 {
+		logger.Infof("Deferred for %s by jitter or blackout", delay.Round(time.Second))
+		if err := sleep(ctx, delay); err != nil {
+			logger.Info("Cancelled, the scheduler is stopped")
+			return
+		}
+	}
+
+	// The paused model is skipped without recording the run
+	if err := pausedError(modelConfig.Name, time.Now()); err != nil {
+		logger.Warnf("Skipped: %v", err)
+		return
+	}
+
+	logger.Info("Performing...")
+
+	// Save before running, a long run is not detected as missed when the daemon is restarted
+	if err := saveLastRun(modelConfig.Name, time.Now()); err != nil {
+		logger.Errorf("Failed to save schedule state: %v", err)
+	}
+
+	newChain(ctx, trigger).run(modelConfig)
+}
+
+// sleep for the duration, the error is returned when ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// runModel perform the model as a job, the failed run is retried by `schedule.retry`.
+// The retries are cancelled by ctx, the running job is not.
+// The failure of the last performed attempt is notified when no more attempt is performed, e.g. the retry is dropped.
+func runModel(ctx context.Context, modelConfig config.ModelConfig, trigger string) error {
+	logger := superlogger.Tag(fmt.Sprintf("Scheduler: %s", modelConfig.Name))
+
+	// unreported the failed attempt without the failure notification
+	var unreported *result.RunResult
+	var unreportedErr error
+
+	retry := modelConfig.Schedule.Retry
+	err := withRetry(ctx, logger, retry, func(attempt, attempts int) (cancelled bool, err error) {
+		m := model.Model{
+			Config: modelConfig,
+		}
+		if attempts > 1 {
+			m.Attempt = attempt
+			m.SkipFailureNotify = attempt < attempts && retry.Notify != config.RetryNotifyEach
+		}
 
-			logger.Info("Performing...")
+		var rr *result.RunResult
+		err = jobs.Run(jobs.WithTrigger(context.Background(), trigger), modelConfig, func(ctx context.Context) (err error) {
+			rr, err = m.Perform(ctx)
+			cancelled = errors.Is(ctx.Err(), context.Canceled)
 
-			m := model.Model{
-				Config: modelConfig,
+			unreported, unreportedErr = nil, nil
+			if err != nil && m.SkipFailureNotify {
+				unreported, unreportedErr = rr, err
 			}
-			mu.Lock()
-			if err := m.Perform(); err != nil {
-				logger.Errorf("Failed to perform: %s", err.Error())
+			return
+		})
+		if err == nil {
+			logger.Infof("Done.\n%s", rr.Summary())
+		}
+
+		return cancelled, err
+	})
+
+	if unreported != nil {
+		logger.Info("Notify the failure, the model is not retried")
+		model.Model{Config: modelConfig}.NotifyFailure(unreported, unreportedErr)
+	}
+
+	return err
+}
+
+// withRetry call run until it succeeds or the attempts are used up,
+// the cancelled run and the skipped run by overlap policy are not retried.
+// The waiting retry is dropped when ctx is done, the error of the last attempt is returned.
+func withRetry(ctx context.Context, logger superlogger.Logger, retry config.RetryConfig, run func(attempt, attempts int) (cancelled bool, err error)) (err error) {
+	attempts := max(retry.Attempts, 1)
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := retry.DelayOf(attempt)
+			logger.Infof("Retry %d/%d in %s", attempt-1, attempts-1, delay)
+			if sleep(ctx, delay) != nil {
+				logger.Info("Retry cancelled, the scheduler is stopped")
+				return err
 			}
-			logger.Info("Done.")
-		}, modelConfig); err != nil {
-			logger.Errorf("Failed to register job func: %s", err.Error())
+		}
+
+		var cancelled bool
+		cancelled, err = run(attempt, attempts)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, jobs.ErrAlreadyRunning) {
+			logger.Warnf("Skipped: %s", err.Error())
+			return err
+		}
+		logger.Errorf("Failed to perform: %s", err.Error())
+
+		// The job is cancelled while it's running, or waiting for the slot, worker or lock
+		if cancelled || errors.Is(err, context.Canceled) {
+			return err
 		}
 	}
 
-	mycron.StartAsync()
+	return err
+}
 
-	return nil
+// startDelay return the random delay of `jitter`, and defer the run to the end of the `blackout` windows
+func startDelay(schedule config.ScheduleConfig, now time.Time) time.Duration {
+	var delay time.Duration
+	if schedule.Jitter > 0 {
+		delay = time.Duration(rand.Int63n(int64(schedule.Jitter)))
+	}
+
+	if schedule.Location != nil {
+		now = now.In(schedule.Location)
+	}
+
+	// The windows may be adjacent or overlapped, defer until none of them matches
+	for i := 0; i < len(schedule.Blackout)+1; i++ {
+		var remaining time.Duration
+		for _, window := range schedule.Blackout {
+			remaining = max(remaining, window.Remaining(now.Add(delay)))
+		}
+		if remaining == 0 {
+			break
+		}
+		delay += remaining
+	}
+
+	return delay
+}
+
+// NextRun return the next scheduled run time of the model, zero if it's not scheduled.
+// It's calculated by the schedule and the last run when the scheduler is not started in this process.
+func NextRun(modelConfig config.ModelConfig) time.Time {
+	if !modelConfig.Schedule.Enabled {
+		return time.Time{}
+	}
+
+	cronMu.Lock()
+	job, ok := cronJobs[modelConfig.Name]
+	cronMu.Unlock()
+	if ok {
+		return job.NextRun()
+	}
+
+	now := time.Now()
+	from := LastRun(modelConfig.Name)
+	if from.IsZero() {
+		from = now
+	}
+	next, err := nextRunAfter(modelConfig.Schedule, from)
+	if err != nil {
+		return time.Time{}
+	}
+	if next.Before(now) {
+		next, _ = nextRunAfter(modelConfig.Schedule, now)
+	}
+
+	return next
 }
 
 func Restart() error {
@@ -98,7 +352,16 @@ func Restart() error {
 }
 
 func Stop() {
-	if mycron != nil {
+	cronMu.Lock()
+	defer cronMu.Unlock()
+
+	for _, mycron := range mycrons {
 		mycron.Stop()
 	}
+	if stopRuns != nil {
+		stopRuns()
+		stopRuns = nil
+	}
+	mycrons = map[string]*gocron.Scheduler{}
+	cronJobs = map[string]*gocron.Job{}
 }
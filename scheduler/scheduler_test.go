@@ -0,0 +1,250 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/jobs"
+	superlogger "github.com/hantbk/vtsbackup/logger"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartDelay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), startDelay(config.ScheduleConfig{}, now))
+
+	for i := 0; i < 10; i++ {
+		delay := startDelay(config.ScheduleConfig{Jitter: time.Minute}, now)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.Less(t, delay, time.Minute)
+	}
+
+	schedule := config.ScheduleConfig{
+		Blackout: []helper.TimeWindow{
+			{Start: 6 * time.Hour, End: 8 * time.Hour},
+			{Start: 8 * time.Hour, End: 9 * time.Hour},
+		},
+	}
+	assert.Equal(t, 2*time.Hour, startDelay(schedule, now))
+	assert.Equal(t, time.Duration(0), startDelay(schedule, now.Add(3*time.Hour)))
+
+	// Blackout is in the timezone of the schedule
+	location := time.FixedZone("UTC+7", 7*60*60)
+	schedule = config.ScheduleConfig{
+		Location: location,
+		Blackout: []helper.TimeWindow{{Start: 13 * time.Hour, End: 15 * time.Hour}},
+	}
+	assert.Equal(t, time.Hour, startDelay(schedule, now))
+}
+
+func TestWithRetry(t *testing.T) {
+	logger := superlogger.Tag("Test")
+	retry := config.RetryConfig{Attempts: 3, Delay: time.Millisecond, Backoff: 2}
+
+	var calls []int
+	err := withRetry(context.Background(), logger, retry, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		assert.Equal(t, 3, attempts)
+		if attempt < 2 {
+			return false, errors.New("boom")
+		}
+		return false, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, calls)
+
+	calls = nil
+	err = withRetry(context.Background(), logger, retry, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		return false, fmt.Errorf("boom %d", attempt)
+	})
+	assert.EqualError(t, err, "boom 3")
+	assert.Equal(t, []int{1, 2, 3}, calls)
+
+	// Not retried
+	calls = nil
+	err = withRetry(context.Background(), logger, retry, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		return true, context.Canceled
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []int{1}, calls)
+
+	// Cancelled while it's waiting for the slot, worker or lock
+	calls = nil
+	err = withRetry(context.Background(), logger, retry, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		return false, context.Canceled
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []int{1}, calls)
+
+	calls = nil
+	err = withRetry(context.Background(), logger, retry, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		return false, fmt.Errorf("model foo is %w", jobs.ErrAlreadyRunning)
+	})
+	assert.ErrorIs(t, err, jobs.ErrAlreadyRunning)
+	assert.Equal(t, []int{1}, calls)
+
+	// No retry config
+	calls = nil
+	err = withRetry(context.Background(), logger, config.RetryConfig{}, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		assert.Equal(t, 1, attempts)
+		return false, errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, []int{1}, calls)
+
+	// The waiting retry is dropped when the scheduler is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = nil
+	start := time.Now()
+	err = withRetry(ctx, logger, config.RetryConfig{Attempts: 3, Delay: time.Hour}, func(attempt, attempts int) (bool, error) {
+		calls = append(calls, attempt)
+		cancel()
+		return false, errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, []int{1}, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRunModel_cancelledInQueue(t *testing.T) {
+	modelConfig := config.ModelConfig{
+		Name:     "run-model-cancelled-in-queue",
+		Overlap:  config.OverlapQueue,
+		Schedule: config.ScheduleConfig{Retry: config.RetryConfig{Attempts: 3, Delay: time.Millisecond, Backoff: 1}},
+	}
+
+	// Hold the slot of the model by a running job
+	release := make(chan struct{})
+	running := make(chan struct{})
+	go jobs.Run(context.Background(), modelConfig, func(ctx context.Context) error {
+		close(running)
+		<-release
+		return nil
+	})
+	defer close(release)
+	<-running
+
+	done := make(chan error)
+	go func() {
+		done <- runModel(context.Background(), modelConfig, jobs.TriggerSchedule)
+	}()
+
+	queued := func() (id string) {
+		for _, status := range jobs.Jobs() {
+			if status.Model == modelConfig.Name && status.State == jobs.StateQueued {
+				id = status.ID
+			}
+		}
+		return
+	}
+	assert.Eventually(t, func() bool { return queued() != "" }, time.Second, time.Millisecond)
+	_, err := jobs.Cancel(queued())
+	assert.NoError(t, err)
+
+	// Not retried
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the cancelled job is retried")
+	}
+	assert.Empty(t, queued())
+
+	count := 0
+	for _, status := range jobs.Jobs() {
+		if status.Model == modelConfig.Name {
+			count++
+		}
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestRunModel_retryDropped(t *testing.T) {
+	var failures atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "has failed") {
+			failures.Add(1)
+		} else {
+			// The scheduler is stopped when the first attempt is started
+			cancel()
+		}
+	}))
+	defer server.Close()
+
+	webhookViper := viper.New()
+	webhookViper.Set("url", server.URL)
+	webhookViper.Set("events", []string{"started", "failed"})
+	modelConfig := config.ModelConfig{
+		Name:         "run-model-retry-dropped",
+		CompressWith: config.SubConfig{Type: "unknown"},
+		Notifiers: map[string]config.SubConfig{
+			"webhook": {Name: "webhook", Type: "webhook", Viper: webhookViper},
+		},
+		Schedule: config.ScheduleConfig{Retry: config.RetryConfig{Attempts: 3, Delay: time.Hour, Backoff: 1, Notify: config.RetryNotifyFinal}},
+	}
+
+	// The failure of the first attempt is notified, though it's performed with SkipFailureNotify
+	err := runModel(ctx, modelConfig, jobs.TriggerSchedule)
+	assert.EqualError(t, err, "unsupported compress type: unknown")
+	assert.Equal(t, int32(1), failures.Load())
+}
+
+func TestPerform_paused(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+
+	assert.NoError(t, Pause("foo", time.Time{}))
+	perform(context.Background(), config.ModelConfig{Name: "foo"}, jobs.TriggerSchedule)
+
+	// The skipped run is not recorded
+	assert.True(t, LastRun("foo").IsZero())
+	assert.True(t, GetState("foo").IsPaused(time.Now()))
+}
+
+func TestPerform_stopped(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The deferred run is dropped when the scheduler is stopped during the delay
+	start := time.Now()
+	perform(ctx, config.ModelConfig{Name: "foo", Schedule: config.ScheduleConfig{Jitter: time.Hour}}, jobs.TriggerSchedule)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, LastRun("foo").IsZero())
+}
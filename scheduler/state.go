@@ -0,0 +1,315 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// statePath the last run times of the models, it's kept across restarts to detect the missed runs
+	statePath = filepath.Join(config.VtsBackupDir, "schedule.json")
+	stateMu   sync.Mutex
+)
+
+// State of the scheduled model
+type State struct {
+	LastRunAt time.Time `json:"last_run_at"`
+	// Paused the scheduled runs are skipped until PausedUntil, zero is until resumed
+	Paused      bool      `json:"paused,omitempty"`
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+}
+
+// IsPaused check the model is paused at t
+func (s State) IsPaused(t time.Time) bool {
+	return s.Paused && (s.PausedUntil.IsZero() || t.Before(s.PausedUntil))
+}
+
+func loadStates() (map[string]State, error) {
+	states := map[string]State{}
+
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return states, err
+	}
+
+	if err := json.Unmarshal(data, &states); err != nil {
+		return states, fmt.Errorf("invalid schedule state %s: %v", statePath, err)
+	}
+
+	return states, nil
+}
+
+// LastRun return the last scheduled run time of the model, zero if it has never run
+func LastRun(name string) time.Time {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	states, _ := loadStates()
+	return states[name].LastRunAt
+}
+
+// GetState return the state of the model
+func GetState(name string) State {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	states, _ := loadStates()
+	return states[name]
+}
+
+func saveLastRun(name string, t time.Time) error {
+	return updateState(name, func(state *State) {
+		state.LastRunAt = t
+	})
+}
+
+// Pause the scheduled runs of the model until the time, zero is until resumed
+func Pause(name string, until time.Time) error {
+	return updateState(name, func(state *State) {
+		state.Paused = true
+		state.PausedUntil = until
+	})
+}
+
+// Resume the scheduled runs of the model
+func Resume(name string) error {
+	return updateState(name, func(state *State) {
+		state.Paused = false
+		state.PausedUntil = time.Time{}
+	})
+}
+
+// ParseUntil parse the time of `--until`, it's a duration from now like `2h`, or a time like `2024-05-01 18:00` or RFC3339
+func ParseUntil(value string, now time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, e.g. 2h, \"2024-05-01 18:00\" or 2024-05-01T18:00:00+07:00", value)
+}
+
+// lockState hold the lock of the state across the processes, e.g. `vtsbackup pause` and the daemon
+func lockState() (unlock func(), err error) {
+	if err := helper.MkdirP(filepath.Dir(statePath)); err != nil {
+		return nil, err
+	}
+
+	lockPath := statePath + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %s: %v", lockPath, err)
+	}
+
+	if err := helper.LockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %v", lockPath, err)
+	}
+
+	return func() {
+		helper.UnlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// updateState update the state of the model and save it
+func updateState(name string, update func(state *State)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	unlock, err := lockState()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	states, err := loadStates()
+	if err != nil {
+		return err
+	}
+	state := states[name]
+	update(&state)
+	states[name] = state
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	// Replace the file at once, the readers without the lock never see a partial file
+	tmpPath := statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0660); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, statePath)
+}
+
+// pausedError return the error of the paused model, nil if it's not paused at t
+func pausedError(name string, t time.Time) error {
+	state := GetState(name)
+	if !state.IsPaused(t) {
+		return nil
+	}
+
+	if !state.PausedUntil.IsZero() {
+		return fmt.Errorf("model %s is paused until %s", name, state.PausedUntil.Format(time.RFC3339))
+	}
+
+	return fmt.Errorf("model %s is paused", name)
+}
+
+// nextRunAfter return the first scheduled time after t
+func nextRunAfter(schedule config.ScheduleConfig, t time.Time) (time.Time, error) {
+	if schedule.Location != nil {
+		t = t.In(schedule.Location)
+	}
+
+	if len(schedule.Cron) > 0 {
+		sched, err := cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return sched.Next(t), nil
+	}
+
+	every, err := time.ParseDuration(schedule.Every)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if every <= 0 {
+		return time.Time{}, fmt.Errorf("invalid every %q", schedule.Every)
+	}
+
+	if len(schedule.At) == 0 {
+		return t.Add(every), nil
+	}
+
+	// With $at, it runs at the time of the day, and the next day is after $every
+	hour, minute, err := parseAt(schedule.At)
+	if err != nil {
+		return time.Time{}, err
+	}
+	after := t
+	if every > 24*time.Hour {
+		after = t.Add(every - 24*time.Hour)
+	}
+	next := time.Date(after.Year(), after.Month(), after.Day(), hour, minute, 0, 0, after.Location())
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next, nil
+}
+
+// parseAt parse the time of the day, e.g. 0:30, 10:00:00
+func parseAt(at string) (hour, minute int, err error) {
+	parts := strings.Split(at, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, fmt.Errorf("invalid at %q", at)
+	}
+
+	hour, err = strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid at %q", at)
+	}
+	minute, err = strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid at %q", at)
+	}
+
+	return hour, minute, nil
+}
+
+// missedRunLookBacks the recent periods to search the latest missed run of the cron first,
+// so the runs in a long outage are not iterated one by one
+var missedRunLookBacks = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 31 * 24 * time.Hour, 366 * 24 * time.Hour}
+
+// missedRun return the latest scheduled time between the last run and now,
+// zero if there is no missed run or the model has never run
+func missedRun(schedule config.ScheduleConfig, lastRun, now time.Time) time.Time {
+	if lastRun.IsZero() {
+		return time.Time{}
+	}
+
+	next, err := nextRunAfter(schedule, lastRun)
+	if err != nil || next.After(now) {
+		return time.Time{}
+	}
+
+	if len(schedule.Cron) == 0 && len(schedule.At) == 0 {
+		// The runs are every $every after the last run
+		every := next.Sub(lastRun)
+		return next.Add(now.Sub(next) / every * every)
+	}
+
+	if len(schedule.Cron) > 0 {
+		for _, lookBack := range missedRunLookBacks {
+			from := now.Add(-lookBack)
+			if !from.After(next) {
+				break
+			}
+			if t, err := nextRunAfter(schedule, from); err == nil && !t.After(now) {
+				next = t
+				break
+			}
+		}
+	}
+
+	for {
+		t, err := nextRunAfter(schedule, next)
+		if err != nil || t.After(now) {
+			return next
+		}
+		next = t
+	}
+}
+
+// catchUpRun return the latest missed run, and whether it's caught up by `catch_up` and `catch_up_max_age`
+func catchUpRun(schedule config.ScheduleConfig, lastRun, now time.Time) (missed time.Time, catchUp bool) {
+	missed = missedRun(schedule, lastRun, now)
+	if missed.IsZero() {
+		return missed, false
+	}
+
+	return missed, schedule.CatchUp && now.Sub(missed) <= schedule.CatchUpMaxAge
+}
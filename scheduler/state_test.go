@@ -0,0 +1,172 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextRunAfter(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 15, 0, 0, time.Local)
+
+	next, err := nextRunAfter(config.ScheduleConfig{Cron: "0 0 * * *"}, base)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local), next)
+
+	next, err = nextRunAfter(config.ScheduleConfig{Every: "1h"}, base)
+	assert.NoError(t, err)
+	assert.Equal(t, base.Add(time.Hour), next)
+
+	next, err = nextRunAfter(config.ScheduleConfig{Every: "24h", At: "0:30"}, base)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 30, 0, 0, time.Local), next)
+
+	next, err = nextRunAfter(config.ScheduleConfig{Every: "48h", At: "10:30"}, base)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 2, 10, 30, 0, 0, time.Local), next)
+
+	_, err = nextRunAfter(config.ScheduleConfig{Every: "1day"}, base)
+	assert.Error(t, err)
+	_, err = nextRunAfter(config.ScheduleConfig{Every: "24h", At: "25:00"}, base)
+	assert.EqualError(t, err, `invalid at "25:00"`)
+}
+
+func TestMissedRun(t *testing.T) {
+	schedule := config.ScheduleConfig{Cron: "0 0 * * *"}
+	now := time.Date(2024, 5, 2, 8, 0, 0, 0, time.Local)
+
+	assert.True(t, missedRun(schedule, time.Time{}, now).IsZero())
+	assert.True(t, missedRun(schedule, time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local), now).IsZero())
+	assert.Equal(t,
+		time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local),
+		missedRun(schedule, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), now),
+	)
+}
+
+func TestMissedRun_latest(t *testing.T) {
+	now := time.Date(2024, 5, 2, 8, 0, 0, 0, time.Local)
+	lastRun := time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)
+
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local), missedRun(config.ScheduleConfig{Cron: "0 0 * * *"}, lastRun, now))
+	assert.Equal(t, time.Date(2024, 4, 29, 0, 0, 0, 0, time.Local), missedRun(config.ScheduleConfig{Cron: "0 0 * * 1"}, lastRun, now))
+	assert.Equal(t, time.Date(2024, 5, 2, 8, 0, 0, 0, time.Local), missedRun(config.ScheduleConfig{Every: "1h"}, lastRun, now))
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 30, 0, 0, time.Local), missedRun(config.ScheduleConfig{Every: "24h", At: "0:30"}, lastRun, now))
+	assert.Equal(t, time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local), missedRun(config.ScheduleConfig{Cron: "0 2 1 * *"}, lastRun, now))
+}
+
+func TestCatchUpRun(t *testing.T) {
+	schedule := config.ScheduleConfig{Cron: "0 * * * *", CatchUp: true, CatchUpMaxAge: 24 * time.Hour}
+	now := time.Date(2024, 5, 2, 8, 30, 0, 0, time.Local)
+
+	// The outage is longer than the max age, the latest missed run is caught up
+	missed, catchUp := catchUpRun(schedule, time.Date(2024, 4, 20, 0, 0, 0, 0, time.Local), now)
+	assert.Equal(t, time.Date(2024, 5, 2, 8, 0, 0, 0, time.Local), missed)
+	assert.True(t, catchUp)
+
+	// The latest missed run is older than the max age
+	schedule.Cron = "0 0 1 * *"
+	missed, catchUp = catchUpRun(schedule, time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), now)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), missed)
+	assert.False(t, catchUp)
+
+	schedule.CatchUp = false
+	schedule.Cron = "0 * * * *"
+	missed, catchUp = catchUpRun(schedule, time.Date(2024, 5, 2, 6, 0, 0, 0, time.Local), now)
+	assert.False(t, missed.IsZero())
+	assert.False(t, catchUp)
+
+	_, catchUp = catchUpRun(schedule, time.Date(2024, 5, 2, 8, 10, 0, 0, time.Local), now)
+	assert.False(t, catchUp)
+}
+
+func TestLastRun(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+
+	assert.True(t, LastRun("foo").IsZero())
+
+	lastRun := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, saveLastRun("foo", lastRun))
+	assert.NoError(t, saveLastRun("bar", lastRun.Add(time.Hour)))
+
+	assert.True(t, lastRun.Equal(LastRun("foo")))
+	assert.True(t, lastRun.Add(time.Hour).Equal(LastRun("bar")))
+}
+
+func TestNextRun(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+
+	model := config.ModelConfig{Name: "foo", Schedule: config.ScheduleConfig{Enabled: true, Every: "1h"}}
+	assert.WithinDuration(t, time.Now().Add(time.Hour), NextRun(model), time.Second)
+
+	assert.NoError(t, saveLastRun("foo", time.Now().Add(-30*time.Minute)))
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), NextRun(model), time.Second)
+
+	model.Schedule.Enabled = false
+	assert.True(t, NextRun(model).IsZero())
+}
+
+func TestPauseResume(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+	now := time.Now()
+
+	lastRun := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, saveLastRun("foo", lastRun))
+	assert.False(t, GetState("foo").IsPaused(now))
+
+	assert.NoError(t, Pause("foo", time.Time{}))
+	state := GetState("foo")
+	assert.True(t, state.IsPaused(now))
+	assert.True(t, state.IsPaused(now.AddDate(1, 0, 0)))
+	// The last run is kept
+	assert.True(t, lastRun.Equal(state.LastRunAt))
+
+	assert.NoError(t, Pause("foo", now.Add(time.Hour)))
+	state = GetState("foo")
+	assert.True(t, state.IsPaused(now))
+	assert.False(t, state.IsPaused(now.Add(2*time.Hour)))
+
+	assert.NoError(t, Resume("foo"))
+	assert.False(t, GetState("foo").IsPaused(now))
+	assert.True(t, lastRun.Equal(GetState("foo").LastRunAt))
+}
+
+func TestParseUntil(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+
+	until, err := ParseUntil("", now)
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	until, err = ParseUntil("2h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Hour), until)
+
+	until, err = ParseUntil("2024-05-01 18:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 18, 0, 0, 0, time.Local), until)
+
+	until, err = ParseUntil("2024-05-01T18:00:00Z", now)
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC).Equal(until))
+
+	_, err = ParseUntil("tomorrow", now)
+	assert.EqualError(t, err, `invalid time "tomorrow", e.g. 2h, "2024-05-01 18:00" or 2024-05-01T18:00:00+07:00`)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+//go:build unix
+
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateState_lock(t *testing.T) {
+	statePath = filepath.Join(t.TempDir(), "schedule.json")
+	assert.NoError(t, saveLastRun("foo", time.Now()))
+
+	// Hold the lock like another process
+	f, err := os.OpenFile(statePath+".lock", os.O_RDWR|os.O_CREATE, 0660)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, helper.LockFile(f))
+
+	done := make(chan error)
+	go func() {
+		done <- Pause("foo", time.Time{})
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the state is updated while it's locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, helper.UnlockFile(f))
+	assert.NoError(t, <-done)
+	assert.True(t, GetState("foo").IsPaused(time.Now()))
+	assert.False(t, GetState("foo").LastRunAt.IsZero())
+}
@@ -16,6 +16,7 @@
 package splitter
 
 import (
+	"context"
 	"fmt"
 
 	"os"
@@ -26,12 +27,13 @@ import (
 	"github.com/hantbk/vtsbackup/config"
 	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/spf13/viper"
 )
 
 // Run splitter
-func Run(archivePath string, model config.ModelConfig) (archiveDirPath string, err error) {
-	logger := logger.Tag("Splitter")
+func Run(ctx context.Context, archivePath string, model config.ModelConfig, rr *result.RunResult) (archiveDirPath string, err error) {
+	logger := logger.TagContext(ctx, "Splitter")
 
 	splitter := model.Splitter
 	if splitter == nil {
@@ -59,13 +61,21 @@ func Run(archivePath string, model config.ModelConfig) (archiveDirPath string, e
 
 	opts := options(splitter)
 	opts = append(opts, archivePath, splitSuffix)
-	_, err = helper.Exec("split", opts...)
+	_, err = helper.ExecContext(ctx, "split", opts...)
 	if err != nil {
 		return
 	}
 
 	logger.Info("Split done")
 
+	entries, err := os.ReadDir(archiveDirPath)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		rr.Files = append(rr.Files, filepath.Join(filepath.Base(archiveDirPath), e.Name()))
+	}
+
 	err = os.Remove(archivePath)
 	if err != nil {
 		return
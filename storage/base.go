@@ -16,14 +16,19 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"time"
 
 	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/jobs"
 	"github.com/hantbk/vtsbackup/logger"
+	"github.com/hantbk/vtsbackup/result"
 	"github.com/spf13/viper"
 )
 
@@ -36,6 +41,7 @@ type Base struct {
 	viper       *viper.Viper
 	keep        int
 	cycler      *Cycler
+	bandwidth   *helper.BandwidthLimit
 }
 
 type FileItem struct {
@@ -48,7 +54,7 @@ type FileItem struct {
 type Storage interface {
 	open() error
 	close()
-	upload(fileKey string) error
+	upload(ctx context.Context, fileKey string) error
 	delete(fileKey string) error
 	list(parent string) ([]FileItem, error)
 	download(fileKey string) (string, error)
@@ -92,13 +98,46 @@ func newBase(model config.ModelConfig, archivePath string, storageConfig config.
 		base.keep = base.viper.GetInt("keep")
 	}
 
+	base.bandwidth, err = config.BandwidthLimitFor(base.viper)
+
 	return
 }
 
-func new(model config.ModelConfig, archivePath string, storageConfig config.SubConfig) (Base, Storage) {
+// newProgressBar create a progress bar for the upload, which reader is limited by `bandwidth_limit`,
+// stops when ctx is done, and reports the uploaded bytes to the job.
+func (b Base) newProgressBar(ctx context.Context, logger logger.Logger, f *os.File) helper.ProgressBar {
+	progress := helper.NewProgressBar(logger, f)
+	if b.bandwidth != nil {
+		logger.Infof("Bandwidth limit: %s", b.bandwidth)
+		progress.Reader = b.bandwidth.Reader(progress.Reader)
+	}
+	progress.Reader = &contextReader{ctx: ctx, reader: progress.Reader, job: jobs.FromContext(ctx)}
+
+	return progress
+}
+
+// contextReader stops reading when ctx is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+	job    *jobs.Job
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+	r.job.AddBytes(int64(n))
+
+	return n, err
+}
+
+func new(model config.ModelConfig, archivePath string, storageConfig config.SubConfig) (Base, Storage, error) {
 	base, err := newBase(model, archivePath, storageConfig)
 	if err != nil {
-		panic(err)
+		return base, nil, fmt.Errorf("storage %s: %v", storageConfig.Name, err)
 	}
 
 	var s Storage
@@ -115,43 +154,50 @@ func new(model config.ModelConfig, archivePath string, storageConfig config.SubC
 		s = &S3{Base: base, Service: "s3"}
 	case "minio":
 		s = &S3{Base: base, Service: "minio"}
+	case "rclone":
+		s = &Rclone{Base: base}
 	default:
-		logger.Errorf("[%s] storage type has not implement.", storageConfig.Type)
+		return base, nil, fmt.Errorf("[%s] storage type has not implement.", storageConfig.Type)
 	}
 
-	return base, s
+	return base, s, nil
 }
 
-// run storage
-func runModel(model config.ModelConfig, archivePath string, storageConfig config.SubConfig) (err error) {
-	logger := logger.Tag("Storage")
+// run storage, the old backups removed by `keep` are returned
+func runModel(ctx context.Context, model config.ModelConfig, archivePath string, storageConfig config.SubConfig) (pruned []string, err error) {
+	logger := logger.TagContext(ctx, "Storage")
 
 	newFileKey := filepath.Base(archivePath)
-	base, s := new(model, archivePath, storageConfig)
+	base, s, err := new(model, archivePath, storageConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	logger.Info("=> Storage: " + storageConfig.Type)
 	err = s.open()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer s.close()
 
-	err = s.upload(newFileKey)
+	err = s.upload(ctx, newFileKey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	base.cycler.run(newFileKey, base.fileKeys, base.keep, s.delete)
-	return nil
+	return base.cycler.run(newFileKey, base.fileKeys, base.keep, s.delete), nil
 }
 
-// Run storage
-func Run(model config.ModelConfig, archivePath string) (err error) {
+// Run storage, the outcome of each storage is added to rr
+func Run(ctx context.Context, model config.ModelConfig, archivePath string, rr *result.RunResult) (err error) {
 	var errors []error
 
 	n := len(model.Storages)
 	for _, storageConfig := range model.Storages {
-		err := runModel(model, archivePath, storageConfig)
+		startedAt := time.Now()
+		pruned, err := runModel(ctx, model, archivePath, storageConfig)
+		rr.AddStorage(storageConfig.Name, storageConfig.Type, time.Since(startedAt), err)
+		rr.AddPruned(storageConfig.Name, pruned)
 		if err != nil {
 			if n == 1 {
 				return err
@@ -172,7 +218,11 @@ func Run(model config.ModelConfig, archivePath string) (err error) {
 // List return file list of storage
 func List(model config.ModelConfig, parent string) (items []FileItem, err error) {
 	if storageConfig, ok := model.Storages[model.DefaultStorage]; ok {
-		_, s := new(model, "", storageConfig)
+		_, s, err := new(model, "", storageConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		err = s.open()
 		if err != nil {
 			return nil, err
@@ -204,8 +254,12 @@ func List(model config.ModelConfig, parent string) (items []FileItem, err error)
 
 func Download(model config.ModelConfig, fileKey string) (string, error) {
 	if storageConfig, ok := model.Storages[model.DefaultStorage]; ok {
-		_, s := new(model, "", storageConfig)
-		err := s.open()
+		_, s, err := new(model, "", storageConfig)
+		if err != nil {
+			return "", err
+		}
+
+		err = s.open()
 		if err != nil {
 			return "", err
 		}
@@ -16,9 +16,13 @@
 package storage
 
 import (
+	"context"
+	"testing"
+
 	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/result"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestBase_newBase(t *testing.T) {
@@ -31,3 +35,24 @@ func TestBase_newBase(t *testing.T) {
 	assert.Equal(t, s.viper, model.Viper)
 	assert.Equal(t, s.keep, 0)
 }
+
+func TestRun_invalidStorage(t *testing.T) {
+	v := viper.New()
+	v.Set("path", t.TempDir())
+	v.Set("bandwidth_limit", "fast")
+	model := config.ModelConfig{
+		Name: "foo",
+		Storages: map[string]config.SubConfig{
+			"local": {Name: "local", Type: "local", Viper: v},
+		},
+	}
+
+	// The run is failed instead of panic
+	rr := result.New("abc", "foo", "manual")
+	err := Run(context.Background(), model, "foo.tar", rr)
+	assert.ErrorContains(t, err, "storage local: bandwidth_limit")
+
+	model.Storages["local"] = config.SubConfig{Name: "local", Type: "dropbox", Viper: viper.New()}
+	err = Run(context.Background(), model, "foo.tar", rr)
+	assert.EqualError(t, err, "[dropbox] storage type has not implement.")
+}
@@ -64,7 +64,8 @@ func (c *Cycler) shiftByKeep(keep int) (first *Package) {
 	return
 }
 
-func (c *Cycler) run(fileKey string, fileKeys []string, keep int, deletePackage func(fileKey string) error) {
+// run add the package and remove the oldest ones beyond keep, the removed keys are returned
+func (c *Cycler) run(fileKey string, fileKeys []string, keep int, deletePackage func(fileKey string) error) (removed []string) {
 	logger := logger.Tag("Cycler")
 
 	cyclerFileName := filepath.Join(cyclerPath, c.name+".json")
@@ -74,7 +75,7 @@ func (c *Cycler) run(fileKey string, fileKeys []string, keep int, deletePackage
 	defer c.save(cyclerFileName)
 
 	if keep == 0 {
-		return
+		return nil
 	}
 
 	for {
@@ -94,9 +95,12 @@ func (c *Cycler) run(fileKey string, fileKeys []string, keep int, deletePackage
 				logger.Warnf("Remove %s failed: %v", k, err)
 			} else {
 				logger.Info("Removed", k)
+				removed = append(removed, k)
 			}
 		}
 	}
+
+	return
 }
 
 func (c *Cycler) load(cyclerFileName string) {
@@ -16,9 +16,12 @@
 package storage
 
 import (
-	"github.com/stretchr/testify/assert"
+	"errors"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCycler_add(t *testing.T) {
@@ -57,3 +60,22 @@ func TestCycler_shiftByKeep(t *testing.T) {
 	assert.Equal(t, len(cycler.packages), 4)
 	assert.Nil(t, pkg)
 }
+
+func TestCycler_run(t *testing.T) {
+	cyclerPath = t.TempDir()
+
+	cycler := Cycler{name: "foo"}
+	deletePackage := func(fileKey string) error {
+		if fileKey == "p2" {
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+
+	assert.Empty(t, cycler.run("p1", nil, 2, deletePackage))
+	assert.Empty(t, cycler.run("p2", nil, 2, deletePackage))
+	assert.Equal(t, []string{"p1"}, cycler.run("p3", nil, 2, deletePackage))
+	// The failed one is not returned
+	assert.Empty(t, cycler.run("p4", nil, 2, deletePackage))
+	assert.FileExists(t, filepath.Join(cyclerPath, "foo.json"))
+}
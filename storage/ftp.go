@@ -16,6 +16,7 @@
 package storage
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/textproto"
@@ -130,8 +131,8 @@ func (s *FTP) mkdir(rpath string) error {
 	return nil
 }
 
-func (s *FTP) upload(fileKey string) error {
-	logger := logger.Tag("FTP")
+func (s *FTP) upload(ctx context.Context, fileKey string) error {
+	logger := logger.TagContext(ctx, "FTP")
 	logger.Info("-> Uploading...")
 
 	var fileKeys []string
@@ -163,7 +164,7 @@ func (s *FTP) upload(fileKey string) error {
 		}
 		defer f.Close()
 
-		progress := helper.NewProgressBar(logger, f)
+		progress := s.newProgressBar(ctx, logger, f)
 		if err := s.client.Stor(remotePath, progress.Reader); err != nil {
 			return progress.Errorf("upload failed %v", err)
 		}
@@ -16,54 +16,214 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"syscall"
 
 	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
 )
 
+const (
+	localModeCopy     = "copy"
+	localModeHardlink = "hardlink"
+	localModeReflink  = "reflink"
+	localModeMove     = "move"
+
+	partialSuffix = ".partial"
+)
+
 // Local storage
 //
 // type: local
 // path: /data/backups
+// mode: copy
+//
+// mode:
+//   - copy: copy the file (default)
+//   - hardlink: hard link the file, fallback to copy when the path is on another filesystem
+//   - reflink: clone the file with copy-on-write (btrfs, xfs), fallback to copy when it is not supported
+//   - move: move the file, fallback to copy when the path is on another filesystem or the model has multiple storages
 type Local struct {
 	Base
 	path string
+	mode string
 }
 
 func (s *Local) open() error {
+	s.viper.SetDefault("mode", localModeCopy)
+
 	s.path = s.viper.GetString("path")
+	s.mode = s.viper.GetString("mode")
+
+	switch s.mode {
+	case localModeCopy, localModeHardlink, localModeReflink, localModeMove:
+	default:
+		return fmt.Errorf("local storage mode %q is not supported, must be one of: copy, hardlink, reflink, move", s.mode)
+	}
+
+	// The archive is still needed by the other storages after this one.
+	if s.mode == localModeMove && len(s.model.Storages) > 1 {
+		logger.Tag("Local").Warn("mode: move is not available with multiple storages, fallback to copy")
+		s.mode = localModeCopy
+	}
+
+	// Related path
+	if !filepath.IsAbs(s.path) {
+		s.path = filepath.Join(s.model.WorkDir, s.path)
+	}
+
 	return helper.MkdirP(s.path)
 }
 
 func (s *Local) close() {}
 
-func (s *Local) upload(fileKey string) (err error) {
-	logger := logger.Tag("Local")
+func (s *Local) upload(ctx context.Context, fileKey string) (err error) {
+	logger := logger.TagContext(ctx, "Local")
 
-	// Related path
-	if !path.IsAbs(s.path) {
-		s.path = path.Join(s.model.WorkDir, s.path)
+	var fileKeys []string
+	if len(s.fileKeys) != 0 {
+		// directory
+		// 2022.12.04.07.09.47/2022.12.04.07.09.47.tar.xz-000
+		fileKeys = s.fileKeys
+	} else {
+		// file
+		// 2022.12.04.07.09.25.tar.xz
+		fileKeys = append(fileKeys, fileKey)
+	}
+
+	for _, key := range fileKeys {
+		sourcePath := filepath.Join(filepath.Dir(s.archivePath), key)
+		targetPath := filepath.Join(s.path, key)
+
+		if err := helper.MkdirP(filepath.Dir(targetPath)); err != nil {
+			return fmt.Errorf("failed to mkdir %q, %v", filepath.Dir(targetPath), err)
+		}
+
+		if err := s.store(ctx, sourcePath, targetPath); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Store succeeded", filepath.Join(s.path, fileKey))
+	return nil
+}
+
+// store the file into targetPath by the mode, the file is written to a `.partial` file first
+// and then renamed to targetPath, so a broken upload will never looks like a complete backup.
+// The moved `.partial` file is the only copy of the archive, it's moved back or kept when it's failed to rename.
+func (s *Local) store(ctx context.Context, sourcePath, targetPath string) error {
+	logger := logger.TagContext(ctx, "Local")
+
+	partialPath := targetPath + partialSuffix
+	moved := false
+	defer func() {
+		if !moved {
+			os.Remove(partialPath)
+		}
+	}()
+
+	var err error
+	switch s.mode {
+	case localModeHardlink:
+		if err = os.Link(sourcePath, partialPath); isCrossDeviceError(err) {
+			logger.Warnf("Hardlink %s is not possible across filesystems, fallback to copy", targetPath)
+			err = s.copyFile(ctx, sourcePath, partialPath)
+		}
+	case localModeReflink:
+		if err = reflinkFile(sourcePath, partialPath); err != nil {
+			logger.Warnf("Reflink %s is not supported (%v), fallback to copy", targetPath, err)
+			err = s.copyFile(ctx, sourcePath, partialPath)
+		}
+	case localModeMove:
+		if err = os.Rename(sourcePath, partialPath); isCrossDeviceError(err) {
+			logger.Warnf("Move %s is not possible across filesystems, fallback to copy", targetPath)
+			if err = s.copyFile(ctx, sourcePath, partialPath); err == nil {
+				err = os.Remove(sourcePath)
+			}
+		}
+		moved = err == nil
+	default:
+		err = s.copyFile(ctx, sourcePath, partialPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s %s to %s: %v", s.mode, sourcePath, partialPath, err)
 	}
 
-	targetPath := path.Join(s.path, fileKey)
-	targetDir := path.Dir(targetPath)
-	if err := helper.MkdirP(targetDir); err != nil {
-		logger.Errorf("failed to mkdir %q, %v", targetDir, err)
+	if err := os.Rename(partialPath, targetPath); err != nil {
+		if moved {
+			if restoreErr := os.Rename(partialPath, sourcePath); restoreErr != nil {
+				return fmt.Errorf("failed to rename %s to %s: %v, the archive is kept in %s", partialPath, targetPath, err, partialPath)
+			}
+		}
+
+		return fmt.Errorf("failed to rename %s to %s: %v", partialPath, targetPath, err)
+	}
+
+	return syncDir(filepath.Dir(targetPath))
+}
+
+// copyFile copy the file content, permission and modification time like `cp -a`, and fsync it.
+func (s *Local) copyFile(ctx context.Context, sourcePath, targetPath string) error {
+	logger := logger.TagContext(ctx, "Local")
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
 	}
+	defer source.Close()
 
-	_, err = helper.Exec("cp", "-a", s.archivePath, targetPath)
+	info, err := source.Stat()
 	if err != nil {
 		return err
 	}
-	logger.Info("Store succeeded", targetPath)
+
+	target, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	progress := s.newProgressBar(ctx, logger, source)
+	if _, err := io.Copy(target, progress.Reader); err != nil {
+		return progress.Errorf("%v", err)
+	}
+
+	if err := target.Sync(); err != nil {
+		return progress.Errorf("fsync %s: %v", targetPath, err)
+	}
+
+	if err := target.Close(); err != nil {
+		return progress.Errorf("%v", err)
+	}
+	progress.Done(targetPath)
+
+	return os.Chtimes(targetPath, info.ModTime(), info.ModTime())
+}
+
+// syncDir fsync the directory to persist the rename
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("fsync %s: %v", dir, err)
+	}
+
 	return nil
 }
 
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
 func (s *Local) delete(fileKey string) (err error) {
 	targetPath := filepath.Join(s.path, fileKey)
 	logger.Info("Deleting", targetPath)
@@ -76,19 +236,26 @@ func (s *Local) list(parent string) ([]FileItem, error) {
 	remotePath := filepath.Join(s.path, parent)
 	var items = []FileItem{}
 
-	files, err := ioutil.ReadDir(remotePath)
+	entries, err := os.ReadDir(remotePath)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, file := range files {
-		if !file.IsDir() {
-			items = append(items, FileItem{
-				Filename:     file.Name(),
-				Size:         file.Size(),
-				LastModified: file.ModTime(),
-			})
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) == partialSuffix {
+			continue
+		}
+
+		file, err := entry.Info()
+		if err != nil {
+			return nil, err
 		}
+
+		items = append(items, FileItem{
+			Filename:     file.Name(),
+			Size:         file.Size(),
+			LastModified: file.ModTime(),
+		})
 	}
 
 	return items, nil
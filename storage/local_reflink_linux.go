@@ -0,0 +1,57 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package storage
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clone the file by FICLONE ioctl, it only works on copy-on-write filesystems like btrfs or xfs.
+func reflinkFile(sourcePath, targetPath string) (err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	target, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		target.Close()
+		if err != nil {
+			os.Remove(targetPath)
+		}
+	}()
+
+	if err = unix.IoctlFileClone(int(target.Fd()), int(source.Fd())); err != nil {
+		return err
+	}
+
+	if err = target.Sync(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(targetPath, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,210 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLocalForTest(t *testing.T, archivePath, mode string) *Local {
+	t.Helper()
+
+	viper := viper.New()
+	viper.Set("path", filepath.Join(t.TempDir(), "backups"))
+	if len(mode) > 0 {
+		viper.Set("mode", mode)
+	}
+
+	base, err := newBase(config.ModelConfig{}, archivePath, config.SubConfig{Type: "local", Name: "local", Viper: viper})
+	assert.NoError(t, err)
+
+	s := &Local{Base: base}
+	assert.NoError(t, s.open())
+
+	return s
+}
+
+func writeArchiveForTest(t *testing.T, name string) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(archivePath, []byte("backup data"), 0640))
+
+	return archivePath
+}
+
+func Test_Local_open(t *testing.T) {
+	v := viper.New()
+	v.Set("path", t.TempDir())
+	v.Set("mode", "symlink")
+
+	base, _ := newBase(config.ModelConfig{}, "foo.tar", config.SubConfig{Viper: v})
+	s := &Local{Base: base}
+	assert.EqualError(t, s.open(), `local storage mode "symlink" is not supported, must be one of: copy, hardlink, reflink, move`)
+
+	s = newLocalForTest(t, "foo.tar", "")
+	assert.Equal(t, "copy", s.mode)
+
+	workDir := t.TempDir()
+	v = viper.New()
+	v.Set("path", "backups")
+	base, _ = newBase(config.ModelConfig{WorkDir: workDir}, "foo.tar", config.SubConfig{Viper: v})
+	s = &Local{Base: base}
+	assert.NoError(t, s.open())
+	assert.Equal(t, filepath.Join(workDir, "backups"), s.path)
+}
+
+func Test_Local_upload(t *testing.T) {
+	for _, mode := range []string{"copy", "hardlink", "reflink", "move"} {
+		archivePath := writeArchiveForTest(t, "2024.09.21.22.49.41.tar.gz")
+		s := newLocalForTest(t, archivePath, mode)
+
+		err := s.upload(context.Background(), filepath.Base(archivePath))
+		assert.NoError(t, err, mode)
+
+		targetPath := filepath.Join(s.path, "2024.09.21.22.49.41.tar.gz")
+		data, err := os.ReadFile(targetPath)
+		assert.NoError(t, err, mode)
+		assert.Equal(t, "backup data", string(data), mode)
+		assert.NoFileExists(t, targetPath+".partial", mode)
+
+		info, err := os.Stat(targetPath)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm(), mode)
+
+		switch mode {
+		case "hardlink":
+			sourceInfo, err := os.Stat(archivePath)
+			assert.NoError(t, err)
+			assert.True(t, os.SameFile(sourceInfo, info))
+		case "move":
+			assert.NoFileExists(t, archivePath)
+		default:
+			assert.FileExists(t, archivePath)
+		}
+
+		items, err := s.list("/")
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+
+		assert.NoError(t, s.delete("2024.09.21.22.49.41.tar.gz"))
+		assert.NoFileExists(t, targetPath)
+	}
+}
+
+func Test_Local_renameFailed(t *testing.T) {
+	for _, mode := range []string{"copy", "move"} {
+		archivePath := writeArchiveForTest(t, "2024.09.21.22.49.41.tar.gz")
+		s := newLocalForTest(t, archivePath, mode)
+
+		// The rename of the partial file fails on the directory with the same name
+		targetPath := filepath.Join(s.path, "2024.09.21.22.49.41.tar.gz")
+		assert.NoError(t, os.MkdirAll(filepath.Join(targetPath, "foo"), 0750))
+
+		err := s.upload(context.Background(), filepath.Base(archivePath))
+		assert.ErrorContains(t, err, "failed to rename", mode)
+		assert.NoFileExists(t, targetPath+".partial", mode)
+
+		// The archive is never lost, it's moved back in move mode
+		data, err := os.ReadFile(archivePath)
+		assert.NoError(t, err, mode)
+		assert.Equal(t, "backup data", string(data), mode)
+	}
+}
+
+func Test_Local_uploadSplitDirectory(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "2024.09.21.22.49.41")
+	assert.NoError(t, os.MkdirAll(archivePath, 0750))
+	for _, name := range []string{"2024.09.21.22.49.41.tar.gz-000", "2024.09.21.22.49.41.tar.gz-001"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(archivePath, name), []byte(name), 0640))
+	}
+
+	s := newLocalForTest(t, archivePath, "copy")
+	assert.Len(t, s.fileKeys, 2)
+
+	err := s.upload(context.Background(), filepath.Base(archivePath))
+	assert.NoError(t, err)
+
+	for _, key := range s.fileKeys {
+		data, err := os.ReadFile(filepath.Join(s.path, key))
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Base(key), string(data))
+	}
+
+	// Cycler removes the files first, and then the directory
+	for _, key := range append(s.fileKeys, "2024.09.21.22.49.41/") {
+		assert.NoError(t, s.delete(key))
+	}
+	assert.NoDirExists(t, filepath.Join(s.path, "2024.09.21.22.49.41"))
+}
+
+func Test_Local_moveWithMultipleStorages(t *testing.T) {
+	viper := viper.New()
+	viper.Set("path", t.TempDir())
+	viper.Set("mode", "move")
+
+	model := config.ModelConfig{
+		Storages: map[string]config.SubConfig{"local": {}, "s3": {}},
+	}
+	base, _ := newBase(model, "foo.tar", config.SubConfig{Viper: viper})
+	s := &Local{Base: base}
+	assert.NoError(t, s.open())
+	assert.Equal(t, "copy", s.mode)
+}
+
+func Test_Local_bandwidthLimit(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "2024.09.21.22.49.41.tar.gz")
+	assert.NoError(t, os.WriteFile(archivePath, make([]byte, 20*1000), 0640))
+
+	v := viper.New()
+	v.Set("path", t.TempDir())
+	v.Set("bandwidth_limit", "100KB/s")
+
+	base, err := newBase(config.ModelConfig{}, archivePath, config.SubConfig{Viper: v})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100*1000), base.bandwidth.Rate)
+
+	s := &Local{Base: base}
+	assert.NoError(t, s.open())
+
+	start := time.Now()
+	assert.NoError(t, s.upload(context.Background(), filepath.Base(archivePath)))
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+
+	v.Set("bandwidth_limit", "fast")
+	_, err = newBase(config.ModelConfig{}, archivePath, config.SubConfig{Viper: v})
+	assert.EqualError(t, err, `bandwidth_limit: invalid rate "fast", e.g. 20MiB/s`)
+}
+
+func Test_Local_uploadCancelled(t *testing.T) {
+	archivePath := writeArchiveForTest(t, "2024.09.21.22.49.41.tar.gz")
+	s := newLocalForTest(t, archivePath, "copy")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.upload(ctx, filepath.Base(archivePath))
+	assert.ErrorContains(t, err, "context canceled")
+	assert.NoFileExists(t, filepath.Join(s.path, "2024.09.21.22.49.41.tar.gz"))
+}
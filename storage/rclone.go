@@ -0,0 +1,237 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/hantbk/vtsbackup/logger"
+)
+
+// Rclone storage, drive any rclone remote (Dropbox, OneDrive, Google Drive...) by the `rclone` command.
+//
+// type: rclone
+// remote: mydrive:backups
+// config: ~/.config/rclone/rclone.conf
+// args: --transfers 1
+type Rclone struct {
+	Base
+	remote     string
+	configFile string
+	args       string
+}
+
+type rcloneItem struct {
+	Path    string    `json:"Path"`
+	Name    string    `json:"Name"`
+	Size    int64     `json:"Size"`
+	ModTime time.Time `json:"ModTime"`
+	IsDir   bool      `json:"IsDir"`
+}
+
+func (s *Rclone) open() error {
+	s.remote = s.viper.GetString("remote")
+	s.configFile = helper.ExplandHome(s.viper.GetString("config"))
+	s.args = s.viper.GetString("args")
+
+	if len(s.remote) == 0 {
+		return fmt.Errorf("rclone remote is required, e.g. `remote: mydrive:backups`")
+	}
+
+	if !strings.Contains(s.remote, ":") {
+		return fmt.Errorf("rclone remote %q is invalid, it must be in `name:path` format", s.remote)
+	}
+
+	return nil
+}
+
+func (s *Rclone) close() {}
+
+// remotePath join the fileKey with the remote, `mydrive:` + `foo` -> `mydrive:foo`, `mydrive:backups` + `foo` -> `mydrive:backups/foo`
+func (s *Rclone) remotePath(fileKey string) string {
+	fileKey = strings.TrimPrefix(fileKey, "/")
+	if len(fileKey) == 0 {
+		return s.remote
+	}
+
+	if strings.HasSuffix(s.remote, ":") {
+		return s.remote + fileKey
+	}
+
+	return path.Join(s.remote, fileKey)
+}
+
+func (s *Rclone) options(command string, args ...string) (opts []string) {
+	opts = append(opts, command)
+	if len(s.configFile) > 0 {
+		opts = append(opts, "--config", s.configFile)
+	}
+	if len(s.args) > 0 {
+		opts = append(opts, strings.Fields(s.args)...)
+	}
+	opts = append(opts, args...)
+
+	return
+}
+
+func (s *Rclone) upload(ctx context.Context, fileKey string) error {
+	logger := logger.TagContext(ctx, "Rclone")
+
+	var fileKeys []string
+	if len(s.fileKeys) != 0 {
+		// directory
+		// 2022.12.04.07.09.47/2022.12.04.07.09.47.tar.xz-000
+		fileKeys = s.fileKeys
+	} else {
+		// file
+		// 2022.12.04.07.09.25.tar.xz
+		fileKeys = append(fileKeys, fileKey)
+	}
+
+	for _, key := range fileKeys {
+		sourcePath := filepath.Join(filepath.Dir(s.archivePath), key)
+		remotePath := s.remotePath(key)
+
+		args := []string{sourcePath, remotePath}
+		if s.bandwidth != nil {
+			args = append([]string{"--bwlimit", rcloneBwLimit(s.bandwidth)}, args...)
+		}
+
+		logger.Info("-> upload to", remotePath)
+		if _, err := helper.ExecContext(ctx, "rclone", s.options("copyto", args...)...); err != nil {
+			return fmt.Errorf("rclone upload %s failed: %s", remotePath, strings.TrimSpace(err.Error()))
+		}
+	}
+
+	logger.Info("Store succeeded")
+	return nil
+}
+
+// rcloneBwLimit convert the bandwidth limit to rclone `--bwlimit` timetable, e.g. `00:00,20971520B 08:00,5242880B 18:00,20971520B`
+func rcloneBwLimit(bl *helper.BandwidthLimit) string {
+	rate := func(r int64) string {
+		if r <= 0 {
+			return "off"
+		}
+		return fmt.Sprintf("%dB", r)
+	}
+
+	if len(bl.Schedules) == 0 {
+		return rate(bl.Rate)
+	}
+
+	// rclone timetable switches the rate at each time, so the default rate must be restored at the end of schedules
+	changes := map[time.Duration]int64{0: bl.Rate}
+	for _, schedule := range bl.Schedules {
+		changes[schedule.End] = bl.Rate
+	}
+	for _, schedule := range bl.Schedules {
+		changes[schedule.Start] = schedule.Rate
+	}
+	// schedule cross midnight is active at 00:00
+	for _, schedule := range bl.Schedules {
+		if schedule.Start > schedule.End {
+			changes[0] = schedule.Rate
+		}
+	}
+
+	offsets := make([]time.Duration, 0, len(changes))
+	for offset := range changes {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	var timetable []string
+	for _, offset := range offsets {
+		timetable = append(timetable, fmt.Sprintf("%02d:%02d,%s", int(offset.Hours()), int(offset.Minutes())%60, rate(changes[offset])))
+	}
+
+	return strings.Join(timetable, " ")
+}
+
+func (s *Rclone) delete(fileKey string) error {
+	logger := logger.Tag("Rclone")
+
+	remotePath := s.remotePath(fileKey)
+	logger.Info("-> remove", remotePath)
+
+	command := "deletefile"
+	if strings.HasSuffix(fileKey, "/") {
+		// directory of the split archive, `purge` removes it with the files,
+		// `rmdir` fails on the bucket remotes (S3, GCS...) whose directory is gone with the last file
+		command = "purge"
+	}
+
+	if _, err := helper.Exec("rclone", s.options(command, remotePath)...); err != nil {
+		return fmt.Errorf("rclone %s %s failed: %s", command, remotePath, strings.TrimSpace(err.Error()))
+	}
+
+	return nil
+}
+
+// list files by `rclone lsjson`
+func (s *Rclone) list(parent string) ([]FileItem, error) {
+	remotePath := s.remotePath(parent)
+
+	out, err := helper.Exec("rclone", s.options("lsjson", "--files-only", remotePath)...)
+	if err != nil {
+		return nil, fmt.Errorf("rclone list %s failed: %s", remotePath, strings.TrimSpace(err.Error()))
+	}
+
+	return parseRcloneItems([]byte(out))
+}
+
+func parseRcloneItems(data []byte) ([]FileItem, error) {
+	var entries []rcloneItem
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse rclone lsjson output: %v", err)
+	}
+
+	var items []FileItem
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+
+		items = append(items, FileItem{
+			Filename:     entry.Path,
+			Size:         entry.Size,
+			LastModified: entry.ModTime,
+		})
+	}
+
+	return items, nil
+}
+
+// Get a public link of the file by `rclone link`, only some remotes support it.
+func (s *Rclone) download(fileKey string) (string, error) {
+	remotePath := s.remotePath(fileKey)
+
+	out, err := helper.Exec("rclone", s.options("link", remotePath)...)
+	if err != nil {
+		return "", fmt.Errorf("rclone link %s failed: %s", remotePath, strings.TrimSpace(err.Error()))
+	}
+
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/helper"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRcloneForTest(remote string) *Rclone {
+	viper := viper.New()
+	viper.Set("remote", remote)
+
+	base, _ := newBase(config.ModelConfig{}, "foo/bar", config.SubConfig{Type: "rclone", Name: "rclone", Viper: viper})
+	return &Rclone{Base: base}
+}
+
+func Test_Rclone_open(t *testing.T) {
+	s := newRcloneForTest("")
+	assert.EqualError(t, s.open(), "rclone remote is required, e.g. `remote: mydrive:backups`")
+
+	s = newRcloneForTest("backups")
+	assert.EqualError(t, s.open(), "rclone remote \"backups\" is invalid, it must be in `name:path` format")
+
+	s = newRcloneForTest("mydrive:backups")
+	s.viper.Set("config", "/etc/rclone.conf")
+	s.viper.Set("args", "--transfers 1  --retries 5")
+	assert.NoError(t, s.open())
+	assert.Equal(t, "mydrive:backups", s.remote)
+
+	assert.Equal(t,
+		[]string{"copyto", "--config", "/etc/rclone.conf", "--transfers", "1", "--retries", "5", "a", "b"},
+		s.options("copyto", "a", "b"),
+	)
+}
+
+func Test_Rclone_remotePath(t *testing.T) {
+	s := newRcloneForTest("mydrive:backups")
+	assert.NoError(t, s.open())
+	assert.Equal(t, "mydrive:backups", s.remotePath("/"))
+	assert.Equal(t, "mydrive:backups/foo.tar.gz", s.remotePath("foo.tar.gz"))
+	assert.Equal(t, "mydrive:backups/2022.12.04/foo.tar.gz-000", s.remotePath("2022.12.04/foo.tar.gz-000"))
+
+	s = newRcloneForTest("mydrive:")
+	assert.NoError(t, s.open())
+	assert.Equal(t, "mydrive:", s.remotePath(""))
+	assert.Equal(t, "mydrive:foo.tar.gz", s.remotePath("foo.tar.gz"))
+}
+
+func Test_parseRcloneItems(t *testing.T) {
+	data := `[
+{"Path":"2024.09.21.22.49.41.tar.gz","Name":"2024.09.21.22.49.41.tar.gz","Size":422,"MimeType":"application/gzip","ModTime":"2024-09-21T15:49:41.339Z","IsDir":false},
+{"Path":"old","Name":"old","Size":-1,"ModTime":"2024-09-20T10:00:00Z","IsDir":true}
+]`
+
+	items, err := parseRcloneItems([]byte(data))
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "2024.09.21.22.49.41.tar.gz", items[0].Filename)
+	assert.Equal(t, int64(422), items[0].Size)
+	assert.Equal(t, time.Date(2024, 9, 21, 15, 49, 41, 339000000, time.UTC), items[0].LastModified.UTC())
+
+	_, err = parseRcloneItems([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func Test_rcloneBwLimit(t *testing.T) {
+	assert.Equal(t, "1048576B", rcloneBwLimit(&helper.BandwidthLimit{Rate: 1048576}))
+
+	bl, err := helper.ParseBandwidthLimit("20MiB/s", map[string]string{
+		"08:00-18:00": "5MiB/s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "00:00,20971520B 08:00,5242880B 18:00,20971520B", rcloneBwLimit(bl))
+
+	bl, err = helper.ParseBandwidthLimit("", map[string]string{
+		"22:00-06:30": "1MiB/s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "00:00,1048576B 06:30,off 22:00,1048576B", rcloneBwLimit(bl))
+}
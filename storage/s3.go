@@ -16,6 +16,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"net/http"
@@ -28,7 +29,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
 )
 
@@ -165,8 +165,8 @@ func (s *S3) open() (err error) {
 func (s *S3) close() {
 }
 
-func (s *S3) upload(fileKey string) (err error) {
-	logger := logger.Tag(s.providerName())
+func (s *S3) upload(ctx context.Context, fileKey string) (err error) {
+	logger := logger.TagContext(ctx, s.providerName())
 
 	var fileKeys []string
 	if len(s.fileKeys) != 0 {
@@ -189,7 +189,7 @@ func (s *S3) upload(fileKey string) (err error) {
 		}
 		defer f.Close()
 
-		progress := helper.NewProgressBar(logger, f)
+		progress := s.newProgressBar(ctx, logger, f)
 
 		input := &s3manager.UploadInput{
 			Bucket: aws.String(s.bucket),
@@ -203,7 +203,7 @@ func (s *S3) upload(fileKey string) (err error) {
 			input.StorageClass = aws.String(s.storageClass)
 		}
 
-		result, err := s.client.Upload(input, func(uploader *s3manager.Uploader) {
+		result, err := s.client.UploadWithContext(ctx, input, func(uploader *s3manager.Uploader) {
 			// set the part size as low as possible to avoid timeouts and aborts
 			// also set concurrency to 1 for the same reason
 			var partSize int64 = 64 * 1024 * 1024 // 64MiB
@@ -19,37 +19,15 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/user"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/bramvdbogaerde/go-scp"
-	"github.com/bramvdbogaerde/go-scp/auth"
-	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
 	"golang.org/x/crypto/ssh"
 )
 
-// SSH
-//
-// host:
-// port: 22
-// username:
-// password:
-// timeout: 300
-// private_key: ~/.ssh/id_rsa
-// passpharase:
-type SSH struct {
-	host        string
-	port        string
-	privateKey  string
-	passpharase string
-	username    string
-	password    string
-}
-
 // SCP storage
 //
 // type: scp
@@ -61,50 +39,21 @@ type SCP struct {
 }
 
 func (s *SCP) open() (err error) {
-	s.viper.SetDefault("port", "22")
-	s.viper.SetDefault("timeout", 300)
-	s.viper.SetDefault("private_key", "~/.ssh/id_rsa")
-
-	s.host = s.viper.GetString("host")
-	s.port = s.viper.GetString("port")
-	s.path = s.viper.GetString("path")
-	s.username = s.viper.GetString("username")
-	s.password = s.viper.GetString("password")
-	s.privateKey = helper.ExplandHome(s.viper.GetString("private_key"))
-	s.passpharase = s.viper.GetString("passpharase")
-
-	if len(s.host) == 0 {
-		return fmt.Errorf("host is required")
-	}
-
-	if len(s.username) == 0 {
-		user, err := user.Current()
-		if err == nil {
-			s.username = user.Username
-		} else {
-			return fmt.Errorf("username is required and it is not able to get current user: %v", err)
-		}
-	}
-
-	sc := sshConfig{
-		username:    s.username,
-		password:    s.password,
-		privateKey:  s.privateKey,
-		passpharase: s.passpharase,
+	if err := s.SSH.load(s.viper); err != nil {
+		return err
 	}
+	s.path = s.viper.GetString("path")
 
-	clientConfig := newSSHClientConfig(sc)
-	clientConfig.Timeout = s.viper.GetDuration("timeout") * time.Second
-
-	sshClient, err := ssh.Dial("tcp", s.host+":"+s.port, &clientConfig)
+	sshClient, err := s.SSH.dial()
 	if err != nil {
-		return fmt.Errorf("failed to ssh %s@%s -p %s: %v", s.username, s.host, s.port, err)
+		return err
 	}
 
 	s.client = sshClient
 
 	// mkdir
 	if err := s.run(fmt.Sprintf("mkdir -p %s", s.path)); err != nil {
+		s.SSH.close()
 		return err
 	}
 
@@ -126,11 +75,11 @@ func (s *SCP) run(cmd string) error {
 }
 
 func (s *SCP) close() {
-	s.client.Close()
+	s.SSH.close()
 }
 
-func (s *SCP) upload(fileKey string) error {
-	logger := logger.Tag("SCP")
+func (s *SCP) upload(ctx context.Context, fileKey string) error {
+	logger := logger.TagContext(ctx, "SCP")
 
 	var fileKeys []string
 	if len(s.fileKeys) != 0 {
@@ -153,7 +102,7 @@ func (s *SCP) upload(fileKey string) error {
 		}
 
 		// upload file
-		if err := s.up(sourcePath, remotePath); err != nil {
+		if err := s.up(ctx, sourcePath, remotePath); err != nil {
 			return err
 		}
 	}
@@ -162,8 +111,8 @@ func (s *SCP) upload(fileKey string) error {
 	return nil
 }
 
-func (s *SCP) up(localPath, remotePath string) error {
-	logger := logger.Tag("SCP")
+func (s *SCP) up(ctx context.Context, localPath, remotePath string) error {
+	logger := logger.TagContext(ctx, "SCP")
 
 	client, err := scp.NewClientBySSH(s.client)
 	if err != nil {
@@ -180,8 +129,8 @@ func (s *SCP) up(localPath, remotePath string) error {
 	}
 	defer file.Close()
 
-	progress := helper.NewProgressBar(logger, file)
-	if err := client.CopyFile(context.Background(), progress.Reader, remotePath, "0644"); err != nil {
+	progress := s.newProgressBar(ctx, logger, file)
+	if err := client.Copy(ctx, progress.Reader, remotePath, "0644", progress.FileLength); err != nil {
 		return progress.Errorf("store %s failed: %v", remotePath, err)
 	}
 	progress.Done(remotePath)
@@ -205,84 +154,6 @@ func (s *SCP) delete(fileKey string) (err error) {
 	return
 }
 
-type sshConfig struct {
-	username    string
-	password    string
-	privateKey  string
-	passpharase string
-}
-
-func newSSHClientConfig(c sshConfig) ssh.ClientConfig {
-	logger := logger.Tag("SSH")
-
-	var auths []ssh.AuthMethod
-	keyCallBack := ssh.InsecureIgnoreHostKey()
-
-	// PrivateKeyWithPassphrase, PrivateKey
-	logger.Debugf("PrivateKey: %s", c.privateKey)
-	if len(c.passpharase) != 0 {
-		if cc, err := auth.PrivateKeyWithPassphrase(
-			c.username,
-			[]byte(c.passpharase),
-			c.privateKey,
-			keyCallBack,
-		); err != nil {
-			logger.Debugf("PrivateKey with passpharase failed: %v", err)
-		} else {
-			auths = append(auths, cc.Auth...)
-			logger.Debug("Added passpharase private key")
-		}
-	} else {
-		if cc, err := auth.PrivateKey(
-			c.username,
-			c.privateKey,
-			keyCallBack,
-		); err != nil {
-			logger.Debugf("PrivateKey failed: %v", err)
-		} else {
-			auths = append(auths, cc.Auth...)
-			logger.Debug("Added private key")
-		}
-	}
-
-	// private key has higher priority than SSH agent here since crypto/ssh will only try the first instance of a particular RFC 4252 method.
-	// https://pkg.go.dev/golang.org/x/crypto/ssh#ClientConfig
-	if len(auths) == 0 {
-		// SshAgent
-		if cc, err := auth.SshAgent(
-			c.username,
-			keyCallBack,
-		); err != nil {
-			logger.Debugf("SSH agent failed: %v", err)
-		} else {
-			auths = append(auths, cc.Auth...)
-			logger.Debug("Added SSH agent")
-		}
-	}
-
-	// PasswordKey
-	if len(c.password) != 0 {
-		if cc, err := auth.PasswordKey(
-			c.username,
-			c.password,
-			keyCallBack,
-		); err != nil {
-			logger.Debugf("SSH agent failed: %v", err)
-		} else {
-			auths = append(auths, cc.Auth...)
-			logger.Debug("Added password key")
-		}
-	}
-
-	logger.Debugf("Auths: %#v", auths)
-
-	return ssh.ClientConfig{
-		User:            c.username,
-		Auth:            auths,
-		HostKeyCallback: keyCallBack,
-	}
-}
-
 func (s *SCP) list(parent string) ([]FileItem, error) {
 	return nil, fmt.Errorf("SCP not support list")
 }
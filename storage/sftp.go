@@ -16,18 +16,15 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/user"
 	"path"
 	"path/filepath"
-	"time"
 
-	"github.com/hantbk/vtsbackup/helper"
 	"github.com/hantbk/vtsbackup/logger"
 	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
 )
 
 // SFTP storage
@@ -41,66 +38,40 @@ type SFTP struct {
 }
 
 func (s *SFTP) open() error {
-	s.viper.SetDefault("port", "22")
-	s.viper.SetDefault("timeout", 300)
-	s.viper.SetDefault("private_key", "~/.ssh/id_rsa")
-
-	s.host = s.viper.GetString("host")
-	s.port = s.viper.GetString("port")
-	s.path = s.viper.GetString("path")
-	s.username = s.viper.GetString("username")
-	s.password = s.viper.GetString("password")
-	s.privateKey = helper.ExplandHome(s.viper.GetString("private_key"))
-	s.passpharase = s.viper.GetString("passpharase")
-
-	if len(s.host) == 0 {
-		return fmt.Errorf("host is required")
-	}
-
-	if len(s.username) == 0 {
-		user, err := user.Current()
-		if err == nil {
-			s.username = user.Username
-		} else {
-			return fmt.Errorf("username is required and it is not able to get current user: %v", err)
-		}
-	}
-
-	sc := sshConfig{
-		username:    s.username,
-		password:    s.password,
-		privateKey:  s.privateKey,
-		passpharase: s.passpharase,
+	if err := s.SSH.load(s.viper); err != nil {
+		return err
 	}
+	s.path = s.viper.GetString("path")
 
-	clientConfig := newSSHClientConfig(sc)
-	clientConfig.Timeout = s.viper.GetDuration("timeout") * time.Second
-
-	sshClient, err := ssh.Dial("tcp", s.host+":"+s.port, &clientConfig)
+	sshClient, err := s.SSH.dial()
 	if err != nil {
-		return fmt.Errorf("failed to ssh %s@%s -p %s: %v", s.username, s.host, s.port, err)
+		return err
 	}
 
 	client, err := sftp.NewClient(sshClient)
 	if err != nil {
+		s.SSH.close()
 		return err
 	}
 
+	s.client = client
+
 	// mkdir
 	if err := client.MkdirAll(s.path); err != nil {
+		s.close()
 		return err
 	}
 
-	s.client = client
 	return nil
 }
 
 func (s *SFTP) close() {
 	s.client.Close()
+	s.SSH.close()
 }
 
-func (s *SFTP) upload(fileKey string) error {
-	logger := logger.Tag("SFTP")
+func (s *SFTP) upload(ctx context.Context, fileKey string) error {
+	logger := logger.TagContext(ctx, "SFTP")
 
 	var fileKeys []string
 	if len(s.fileKeys) != 0 {
@@ -125,7 +96,7 @@ func (s *SFTP) upload(fileKey string) error {
 	for _, key := range fileKeys {
 		sourcePath := filepath.Join(filepath.Dir(s.archivePath), key)
 		remotePath := filepath.Join(s.path, key)
-		if err := s.up(sourcePath, remotePath); err != nil {
+		if err := s.up(ctx, sourcePath, remotePath); err != nil {
 			return err
 		}
 	}
@@ -134,8 +105,8 @@ func (s *SFTP) upload(fileKey string) error {
 	return nil
 }
 
-func (s *SFTP) up(localPath, remotePath string) error {
-	logger := logger.Tag("SFTP")
+func (s *SFTP) up(ctx context.Context, localPath, remotePath string) error {
+	logger := logger.TagContext(ctx, "SFTP")
 
 	file, err := os.Open(localPath)
 	if err != nil {
@@ -152,11 +123,12 @@ func (s *SFTP) up(localPath, remotePath string) error {
 	}
 	defer remoteFile.Close()
 
-	if _, err := io.Copy(remoteFile, file); err != nil {
+	progress := s.newProgressBar(ctx, logger, file)
+	if _, err := io.Copy(remoteFile, progress.Reader); err != nil {
 		logger.Errorf("Unable to upload local file %s: %v", localPath, err)
-		return err
+		return progress.Errorf("%v", err)
 	}
-	logger.Infof("Store %s succeeded", remotePath)
+	progress.Done(remotePath)
 
 	return nil
 }
@@ -0,0 +1,613 @@
+// Copyright © 2024 Ha Nguyen <captainnemot1k60@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKeyForTest(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	key, err := ssh.NewPublicKey(pub)
+	assert.NoError(t, err)
+
+	return key
+}
+
+func usePinnedKnownHostsForTest(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	origin := pinnedKnownHostsPath
+	pinnedKnownHostsPath = path
+	t.Cleanup(func() { pinnedKnownHostsPath = origin })
+
+	return path
+}
+
+func Test_SSH_load(t *testing.T) {
+	s := &SSH{}
+	assert.EqualError(t, s.load(viper.New()), "host is required")
+
+	v := viper.New()
+	v.Set("host", "backup.example.com")
+	v.Set("username", "ubuntu")
+	v.Set("host_key", " SHA256:foo ")
+	v.Set("trust_on_first_use", true)
+	assert.NoError(t, s.load(v))
+
+	assert.Equal(t, "22", s.port)
+	assert.Equal(t, filepath.Join(os.Getenv("HOME"), ".ssh/known_hosts"), s.knownHosts)
+	assert.Equal(t, "SHA256:foo", s.hostKey)
+	assert.True(t, s.trustOnFirstUse)
+	assert.False(t, s.insecureIgnoreHostKey)
+	assert.Equal(t, float64(300), s.timeout.Seconds())
+}
+
+func Test_SSH_hostKeyCallback_hostKey(t *testing.T) {
+	usePinnedKnownHostsForTest(t)
+	key := newHostKeyForTest(t)
+	otherKey := newHostKeyForTest(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	for _, hostKey := range []string{
+		string(ssh.MarshalAuthorizedKey(key)),
+		knownhosts.Line([]string{"backup.example.com"}, key),
+		ssh.FingerprintSHA256(key),
+	} {
+		s := &SSH{host: "backup.example.com", hostKey: hostKey}
+		callback, err := s.hostKeyCallback()
+		assert.NoError(t, err)
+
+		assert.NoError(t, callback("backup.example.com:22", remote, key))
+		err = callback("backup.example.com:22", remote, otherKey)
+		assert.ErrorContains(t, err, "host key mismatch for backup.example.com:22")
+		assert.ErrorContains(t, err, ssh.FingerprintSHA256(otherKey))
+	}
+
+	s := &SSH{host: "backup.example.com", hostKey: "not-a-key"}
+	_, err := s.hostKeyCallback()
+	assert.ErrorContains(t, err, "invalid host_key")
+}
+
+func Test_SSH_hostKeyCallback_knownHosts(t *testing.T) {
+	usePinnedKnownHostsForTest(t)
+	key := newHostKeyForTest(t)
+	otherKey := newHostKeyForTest(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	// no known_hosts
+	s := &SSH{host: "backup.example.com", knownHosts: filepath.Join(t.TempDir(), "not-exist")}
+	_, err := s.hostKeyCallback()
+	assert.ErrorContains(t, err, "no known_hosts file found")
+
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	assert.NoError(t, os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{"backup.example.com"}, key)+"\n"), 0600))
+
+	s = &SSH{host: "backup.example.com", knownHosts: knownHostsPath}
+	callback, err := s.hostKeyCallback()
+	assert.NoError(t, err)
+
+	assert.NoError(t, callback("backup.example.com:22", remote, key))
+
+	err = callback("backup.example.com:22", remote, otherKey)
+	assert.ErrorContains(t, err, "host key mismatch for backup.example.com:22: presented ssh-ed25519 "+ssh.FingerprintSHA256(otherKey))
+	assert.ErrorContains(t, err, "expected "+ssh.FingerprintSHA256(key))
+
+	err = callback("other.example.com:22", remote, key)
+	assert.ErrorContains(t, err, "host key of other.example.com:22 is unknown: presented ssh-ed25519 "+ssh.FingerprintSHA256(key))
+
+	// insecure
+	s = &SSH{host: "backup.example.com", knownHosts: knownHostsPath, insecureIgnoreHostKey: true}
+	callback, err = s.hostKeyCallback()
+	assert.NoError(t, err)
+	assert.NoError(t, callback("backup.example.com:22", remote, otherKey))
+}
+
+func Test_SSH_hostKeyCallback_trustOnFirstUse(t *testing.T) {
+	pinnedPath := usePinnedKnownHostsForTest(t)
+	key := newHostKeyForTest(t)
+	otherKey := newHostKeyForTest(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	s := &SSH{host: "backup.example.com", knownHosts: filepath.Join(t.TempDir(), "not-exist"), trustOnFirstUse: true}
+	callback, err := s.hostKeyCallback()
+	assert.NoError(t, err)
+
+	// first use, pin it
+	assert.NoError(t, callback("backup.example.com:22", remote, key))
+	assert.FileExists(t, pinnedPath)
+
+	// reload pinned keys
+	callback, err = s.hostKeyCallback()
+	assert.NoError(t, err)
+	assert.NoError(t, callback("backup.example.com:22", remote, key))
+
+	err = callback("backup.example.com:22", remote, otherKey)
+	assert.ErrorContains(t, err, "host key mismatch for backup.example.com:22")
+}
+
+func Test_SSH_hostKeyAlgorithms(t *testing.T) {
+	usePinnedKnownHostsForTest(t)
+	key := newHostKeyForTest(t)
+
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaKey, err := ssh.NewPublicKey(&rsaPriv.PublicKey)
+	assert.NoError(t, err)
+
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	assert.NoError(t, os.WriteFile(knownHostsPath, []byte(
+		knownhosts.Line([]string{"backup.example.com"}, key)+"\n"+
+			knownhosts.Line([]string{"[rsa.example.com]:2222"}, rsaKey)+"\n"), 0600))
+
+	s := &SSH{knownHosts: knownHostsPath}
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, s.hostKeyAlgorithms("backup.example.com:22"))
+	assert.Equal(t, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, s.hostKeyAlgorithms("rsa.example.com:2222"))
+	assert.Nil(t, s.hostKeyAlgorithms("other.example.com:22"))
+
+	s = &SSH{hostKey: string(ssh.MarshalAuthorizedKey(rsaKey))}
+	assert.Equal(t, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, s.hostKeyAlgorithms("backup.example.com:22"))
+
+	s = &SSH{hostKey: ssh.FingerprintSHA256(key)}
+	assert.Nil(t, s.hostKeyAlgorithms("backup.example.com:22"))
+
+	s = &SSH{knownHosts: knownHostsPath, insecureIgnoreHostKey: true}
+	assert.Nil(t, s.hostKeyAlgorithms("backup.example.com:22"))
+}
+
+type testSSHServer struct {
+	addr       string
+	hostKey    ssh.PublicKey
+	mu         sync.Mutex
+	forwards   []string
+	keepalives int
+	// dropKeepalives don't reply the keepalives, like a dead connection
+	dropKeepalives bool
+}
+
+// newTestSSHServer start an in-process SSH server which supports `direct-tcpip` forwarding for jump hosts
+func newTestSSHServer(t *testing.T, serverConfig *ssh.ServerConfig) *testSSHServer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.NoError(t, err)
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testSSHServer{addr: listener.Addr().String(), hostKey: signer.PublicKey()}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(conn, serverConfig)
+		}
+	}()
+
+	return server
+}
+
+func (server *testSSHServer) handle(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go func() {
+		for req := range reqs {
+			if req.Type == "keepalive@openssh.com" {
+				server.mu.Lock()
+				server.keepalives++
+				drop := server.dropKeepalives
+				server.mu.Unlock()
+				if drop {
+					continue
+				}
+			}
+			if req.WantReply {
+				_ = req.Reply(true, nil)
+			}
+		}
+	}()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "not supported")
+			continue
+		}
+
+		var payload struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		target := net.JoinHostPort(payload.Host, fmt.Sprintf("%d", payload.Port))
+		server.mu.Lock()
+		server.forwards = append(server.forwards, target)
+		server.mu.Unlock()
+
+		targetConn, err := net.Dial("tcp", target)
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			targetConn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			_, _ = io.Copy(channel, targetConn)
+		}()
+		go func() {
+			defer targetConn.Close()
+			_, _ = io.Copy(targetConn, channel)
+		}()
+	}
+}
+
+func (server *testSSHServer) viper(username, password string) *viper.Viper {
+	host, port, _ := net.SplitHostPort(server.addr)
+
+	v := viper.New()
+	v.Set("host", host)
+	v.Set("port", port)
+	v.Set("username", username)
+	v.Set("password", password)
+	v.Set("private_key", "/not-exist/id_rsa")
+	v.Set("host_key", ssh.FingerprintSHA256(server.hostKey))
+	v.Set("timeout", 5)
+
+	return v
+}
+
+func passwordServerConfig(username, password string) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == username && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+	}
+}
+
+func Test_SSH_dial(t *testing.T) {
+	server := newTestSSHServer(t, passwordServerConfig("backup", "secret"))
+
+	s := &SSH{}
+	assert.NoError(t, s.load(server.viper("backup", "secret")))
+	client, err := s.dial()
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	s.close()
+	assert.Nil(t, s.clients)
+
+	s = &SSH{}
+	assert.NoError(t, s.load(server.viper("backup", "wrong")))
+	_, err = s.dial()
+	assert.ErrorContains(t, err, "failed to ssh backup@127.0.0.1")
+}
+
+func Test_SSH_dialKnownHostKeyAlgorithm(t *testing.T) {
+	usePinnedKnownHostsForTest(t)
+
+	// The server prefers ECDSA by the default algorithms of the client, but only the ed25519 key is known
+	serverConfig := passwordServerConfig("backup", "secret")
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaPriv)
+	assert.NoError(t, err)
+	serverConfig.AddHostKey(ecdsaSigner)
+	server := newTestSSHServer(t, serverConfig)
+
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	assert.NoError(t, os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, server.hostKey)+"\n"), 0600))
+
+	v := server.viper("backup", "secret")
+	v.Set("host_key", "")
+	v.Set("known_hosts", knownHostsPath)
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	client, err := s.dial()
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	s.close()
+}
+
+func Test_SSH_dialJumpHosts(t *testing.T) {
+	bastion := newTestSSHServer(t, passwordServerConfig("jump", "jump-secret"))
+	target := newTestSSHServer(t, passwordServerConfig("backup", "secret"))
+
+	bastionHost, bastionPort, _ := net.SplitHostPort(bastion.addr)
+	v := target.viper("backup", "secret")
+	v.Set("keepalive_interval", 1)
+	v.Set("jump_hosts", []any{
+		map[string]any{
+			"host":        bastionHost,
+			"port":        bastionPort,
+			"username":    "jump",
+			"password":    "jump-secret",
+			"private_key": "/not-exist/id_rsa",
+			"host_key":    string(ssh.MarshalAuthorizedKey(bastion.hostKey)),
+		},
+	})
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	assert.Len(t, s.jumpHosts, 1)
+	assert.Equal(t, "jump", s.jumpHosts[0].username)
+	assert.Equal(t, s.timeout, s.jumpHosts[0].timeout)
+
+	client, err := s.dial()
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	assert.Len(t, s.clients, 2)
+	assert.Equal(t, []string{target.addr}, bastion.forwards)
+
+	// keepalive to the jump host and the host
+	assert.Eventually(t, func() bool {
+		bastion.mu.Lock()
+		defer bastion.mu.Unlock()
+		target.mu.Lock()
+		defer target.mu.Unlock()
+		return bastion.keepalives > 0 && target.keepalives > 0
+	}, 3*time.Second, 50*time.Millisecond)
+	s.close()
+
+	// host key of the jump host is verified too
+	v.Set("jump_hosts", []any{
+		map[string]any{
+			"host":     bastionHost,
+			"port":     bastionPort,
+			"username": "jump",
+			"password": "jump-secret",
+			"host_key": ssh.FingerprintSHA256(target.hostKey),
+		},
+	})
+	s = &SSH{}
+	assert.NoError(t, s.load(v))
+	_, err = s.dial()
+	assert.ErrorContains(t, err, "host key mismatch")
+	assert.Nil(t, s.clients)
+}
+
+func Test_SSH_dialTimeout(t *testing.T) {
+	// The server accepts the connection but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	v := viper.New()
+	v.Set("host", host)
+	v.Set("port", port)
+	v.Set("username", "backup")
+	v.Set("insecure_ignore_host_key", true)
+	v.Set("timeout", 1)
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	start := time.Now()
+	_, err = s.dial()
+	assert.ErrorContains(t, err, "failed to ssh backup@127.0.0.1")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The hung host behind the jump host
+	bastion := newTestSSHServer(t, passwordServerConfig("jump", "jump-secret"))
+	bastionHost, bastionPort, _ := net.SplitHostPort(bastion.addr)
+	v.Set("jump_hosts", []any{
+		map[string]any{
+			"host":     bastionHost,
+			"port":     bastionPort,
+			"username": "jump",
+			"password": "jump-secret",
+			"host_key": ssh.FingerprintSHA256(bastion.hostKey),
+		},
+	})
+
+	s = &SSH{}
+	assert.NoError(t, s.load(v))
+	start = time.Now()
+	_, err = s.dial()
+	assert.ErrorContains(t, err, "failed to ssh backup@127.0.0.1")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Nil(t, s.clients)
+}
+
+func Test_SSH_keepAliveDeadConnection(t *testing.T) {
+	server := newTestSSHServer(t, passwordServerConfig("backup", "secret"))
+
+	v := server.viper("backup", "secret")
+	v.Set("keepalive_interval", 1)
+	v.Set("keepalive_count_max", 2)
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	s.keepAliveInterval = 50 * time.Millisecond
+	client, err := s.dial()
+	assert.NoError(t, err)
+	defer s.close()
+
+	server.mu.Lock()
+	server.dropKeepalives = true
+	server.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the dead connection is not closed")
+	}
+}
+
+func Test_SSH_dialCertificate(t *testing.T) {
+	_, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	caSigner, err := ssh.NewSignerFromKey(caPriv)
+	assert.NoError(t, err)
+
+	userPub, userPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	userKey, err := ssh.NewPublicKey(userPub)
+	assert.NoError(t, err)
+
+	cert := &ssh.Certificate{
+		Key:             userKey,
+		CertType:        ssh.UserCert,
+		KeyId:           "backup",
+		ValidPrincipals: []string{"backup"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, caSigner))
+
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "id_ed25519")
+	certificatePath := filepath.Join(dir, "id_ed25519-cert.pub")
+	block, err := ssh.MarshalPrivateKey(userPriv, "")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(privateKeyPath, pem.EncodeToMemory(block), 0600))
+	assert.NoError(t, os.WriteFile(certificatePath, ssh.MarshalAuthorizedKey(cert), 0600))
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), caSigner.PublicKey().Marshal())
+		},
+	}
+	server := newTestSSHServer(t, &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate})
+
+	v := server.viper("backup", "")
+	v.Set("private_key", privateKeyPath)
+	v.Set("certificate", certificatePath)
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	_, err = s.dial()
+	assert.NoError(t, err)
+	s.close()
+
+	// without certificate
+	v.Set("certificate", "")
+	s = &SSH{}
+	assert.NoError(t, s.load(v))
+	_, err = s.dial()
+	assert.ErrorContains(t, err, "unable to authenticate")
+}
+
+func Test_SSH_dialHTTPProxy(t *testing.T) {
+	server := newTestSSHServer(t, passwordServerConfig("backup", "secret"))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	connects := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		connects <- req.Method + " " + req.Host + " " + req.Header.Get("Proxy-Authorization")
+
+		targetConn, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer targetConn.Close()
+
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() { _, _ = io.Copy(targetConn, conn) }()
+		_, _ = io.Copy(conn, targetConn)
+	}()
+
+	v := server.viper("backup", "secret")
+	v.Set("proxy", "http://proxy-user:proxy-pass@"+listener.Addr().String())
+
+	s := &SSH{}
+	assert.NoError(t, s.load(v))
+	_, err = s.dial()
+	assert.NoError(t, err)
+	s.close()
+
+	assert.Equal(t, "CONNECT "+server.addr+" Basic cHJveHktdXNlcjpwcm94eS1wYXNz", <-connects)
+
+	_, err = dialProxy(&net.Dialer{}, "ftp://127.0.0.1:21", server.addr)
+	assert.EqualError(t, err, `proxy scheme "ftp" is not supported, must be socks5 or http`)
+}
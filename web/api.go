@@ -17,19 +17,25 @@ package web
 
 import (
 	"bufio"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/history"
+	"github.com/hantbk/vtsbackup/jobs"
 	"github.com/hantbk/vtsbackup/logger"
 	"github.com/hantbk/vtsbackup/model"
+	"github.com/hantbk/vtsbackup/scheduler"
 	"github.com/hantbk/vtsbackup/storage"
 	"github.com/stoicperlman/fls"
 )
@@ -133,6 +139,12 @@ func setupRouter(version string) *gin.Engine {
 	group.GET("/list", list)
 	group.GET("/download", download)
 	group.POST("/perform", perform)
+	group.GET("/jobs", listJobs)
+	group.GET("/jobs/:id", getJob)
+	group.DELETE("/jobs/:id", cancelJob)
+	group.GET("/history", listHistory)
+	group.POST("/models/:name/pause", pauseModel)
+	group.POST("/models/:name/resume", resumeModel)
 	group.GET("/log", log)
 	return r
 }
@@ -141,10 +153,15 @@ func setupRouter(version string) *gin.Engine {
 func getConfig(c *gin.Context) {
 	models := map[string]any{}
 	for _, m := range model.GetModels() {
+		state := scheduler.GetState(m.Config.Name)
 		models[m.Config.Name] = gin.H{
 			"description":   m.Config.Description,
 			"schedule":      m.Config.Schedule,
 			"schedule_info": m.Config.Schedule.String(),
+			"last_run_at":   timeOrNil(scheduler.LastRun(m.Config.Name)),
+			"next_run_at":   timeOrNil(scheduler.NextRun(m.Config)),
+			"paused":        state.IsPaused(time.Now()),
+			"paused_until":  timeOrNil(state.PausedUntil),
 		}
 	}
 
@@ -153,6 +170,14 @@ func getConfig(c *gin.Context) {
 	})
 }
 
+// timeOrNil return nil for the zero time, so it's null in JSON
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 // POST /api/perform
 func perform(c *gin.Context) {
 	type performParam struct {
@@ -170,12 +195,112 @@ func perform(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		if err := m.Perform(); err != nil {
+	job, err := jobs.Start(jobs.WithTrigger(context.Background(), jobs.TriggerAPI), m.Config, func(ctx context.Context) error {
+		err := m.Run(ctx)
+		if err != nil {
 			logger.Errorf("Perform error: %v", err)
 		}
-	}()
-	c.JSON(200, gin.H{"message": fmt.Sprintf("Backup: %s performed in background.", param.Model)})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, jobs.ErrAlreadyRunning) {
+			c.AbortWithError(409, err)
+		} else {
+			c.AbortWithError(500, err)
+		}
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": fmt.Sprintf("Backup: %s performed in background.", param.Model),
+		"job":     job.Status(),
+	})
+}
+
+// POST /api/models/:name/pause
+func pauseModel(c *gin.Context) {
+	type pauseParam struct {
+		Until string `form:"until" json:"until"`
+	}
+
+	var param pauseParam
+	if err := c.ShouldBind(&param); err != nil {
+		logger.Errorf("Bind error: %v", err)
+	}
+
+	name := c.Param("name")
+	if model.GetModelByName(name) == nil {
+		c.AbortWithError(404, fmt.Errorf("model: \"%s\" not found", name))
+		return
+	}
+
+	until, err := scheduler.ParseUntil(param.Until, time.Now())
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	if err := scheduler.Pause(name, until); err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":      fmt.Sprintf("Model: %s paused.", name),
+		"paused_until": timeOrNil(until),
+	})
+}
+
+// POST /api/models/:name/resume
+func resumeModel(c *gin.Context) {
+	name := c.Param("name")
+	if model.GetModelByName(name) == nil {
+		c.AbortWithError(404, fmt.Errorf("model: \"%s\" not found", name))
+		return
+	}
+
+	if err := scheduler.Resume(name); err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": fmt.Sprintf("Model: %s resumed.", name),
+	})
+}
+
+// GET /api/jobs
+func listJobs(c *gin.Context) {
+	c.JSON(200, gin.H{"jobs": jobs.Jobs()})
+}
+
+// GET /api/jobs/:id
+func getJob(c *gin.Context) {
+	job := jobs.Get(c.Param("id"))
+	if job == nil {
+		c.AbortWithError(404, fmt.Errorf("job: \"%s\" not found", c.Param("id")))
+		return
+	}
+
+	c.JSON(200, job.Status())
+}
+
+// DELETE /api/jobs/:id
+func cancelJob(c *gin.Context) {
+	job, err := jobs.Cancel(c.Param("id"))
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		c.AbortWithError(404, fmt.Errorf("job: \"%s\" not found", c.Param("id")))
+		return
+	}
+	if err != nil {
+		c.AbortWithError(409, fmt.Errorf("job: \"%s\" %v", c.Param("id"), err))
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"message": fmt.Sprintf("Job: %s cancelling.", job.ID()),
+		"job":     job.Status(),
+	})
 }
 
 // GET /api/list?model=xxx&parent=
@@ -225,6 +350,29 @@ func download(c *gin.Context) {
 	c.Redirect(302, downloadURL)
 }
 
+// GET /api/history?model=xxx&limit=
+func listHistory(c *gin.Context) {
+	modelName := c.Query("model")
+	if len(modelName) > 0 && model.GetModelByName(modelName) == nil {
+		c.AbortWithError(404, fmt.Errorf("model: \"%s\" not found", modelName))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		c.AbortWithError(400, fmt.Errorf("invalid limit: %s", c.Query("limit")))
+		return
+	}
+
+	records, err := history.List(modelName, limit)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"history": records})
+}
+
 // GET /api/log
 func log(c *gin.Context) {
 	// https://github.com/gin-gonic/examples/blob/master/realtime-chat/main.go#L27
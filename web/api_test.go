@@ -17,13 +17,17 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hantbk/vtsbackup/config"
+	"github.com/hantbk/vtsbackup/jobs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -72,14 +76,99 @@ func TestAPIStatus(t *testing.T) {
 }
 
 func TestAPIGetModels(t *testing.T) {
-	code, _ := invokeHttp("GET", "/api/config", nil, nil)
+	code, body := invokeHttp("GET", "/api/config", nil, nil)
 
 	assert.Equal(t, 200, code)
+
+	var resp struct {
+		Models map[string]struct {
+			NextRunAt *time.Time `json:"next_run_at"`
+		} `json:"models"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &resp))
+	assert.NotNil(t, resp.Models["test"].NextRunAt)
+	assert.Nil(t, resp.Models["test_model"].NextRunAt)
 }
 
 func TestAPIPostPeform(t *testing.T) {
 	code, body := invokeHttp("POST", "/api/perform", nil, gin.H{"model": "test"})
 
 	assert.Equal(t, 200, code)
-	assertMatchJSON(t, gin.H{"message": "Backup: test performed in background."}, body)
+
+	var result struct {
+		Message string      `json:"message"`
+		Job     jobs.Status `json:"job"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, "Backup: test performed in background.", result.Message)
+	assert.Equal(t, "test", result.Job.Model)
+	assert.NotEmpty(t, result.Job.ID)
+
+	code, body = invokeHttp("GET", "/api/jobs/"+result.Job.ID, nil, nil)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, `"model":"test"`)
+
+	code, body = invokeHttp("GET", "/api/jobs", nil, nil)
+	assert.Equal(t, 200, code)
+	assert.Contains(t, body, result.Job.ID)
+
+	<-jobs.Get(result.Job.ID).Done()
+	code, body = invokeHttp("DELETE", "/api/jobs/"+result.Job.ID, nil, nil)
+	assert.Equal(t, 409, code)
+	assertMatchJSON(t, gin.H{"message": fmt.Sprintf(`Error #01: job: "%s" job is finished`+"\n", result.Job.ID)}, body)
+}
+
+func TestAPIPostPeformAlreadyRunning(t *testing.T) {
+	for i := range config.Models {
+		if config.Models[i].Name == "test" {
+			origin := config.Models[i].Overlap
+			config.Models[i].Overlap = config.OverlapSkip
+			defer func() { config.Models[i].Overlap = origin }()
+		}
+	}
+
+	release := make(chan struct{})
+	job, err := jobs.Start(context.Background(), *config.GetModelConfigByName("test"), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	assert.NoError(t, err)
+	defer func() {
+		close(release)
+		<-job.Done()
+	}()
+
+	code, body := invokeHttp("POST", "/api/perform", nil, gin.H{"model": "test"})
+	assert.Equal(t, 409, code)
+	assertMatchJSON(t, gin.H{"message": "Error #01: model test is already running\n"}, body)
+}
+
+func TestAPIJobNotFound(t *testing.T) {
+	code, body := invokeHttp("GET", "/api/jobs/foo", nil, nil)
+	assert.Equal(t, 404, code)
+	assertMatchJSON(t, gin.H{"message": "Error #01: job: \"foo\" not found\n"}, body)
+
+	code, _ = invokeHttp("DELETE", "/api/jobs/foo", nil, nil)
+	assert.Equal(t, 404, code)
+}
+
+func TestAPIHistory(t *testing.T) {
+	code, body := invokeHttp("GET", "/api/history?model=foo", nil, nil)
+	assert.Equal(t, 404, code)
+	assertMatchJSON(t, gin.H{"message": "Error #01: model: \"foo\" not found\n"}, body)
+
+	code, _ = invokeHttp("GET", "/api/history?limit=foo", nil, nil)
+	assert.Equal(t, 400, code)
+}
+
+func TestAPIPauseResume(t *testing.T) {
+	code, body := invokeHttp("POST", "/api/models/foo/pause", nil, nil)
+	assert.Equal(t, 404, code)
+	assertMatchJSON(t, gin.H{"message": "Error #01: model: \"foo\" not found\n"}, body)
+
+	code, _ = invokeHttp("POST", "/api/models/test/pause", nil, gin.H{"until": "foo"})
+	assert.Equal(t, 400, code)
+
+	code, _ = invokeHttp("POST", "/api/models/foo/resume", nil, nil)
+	assert.Equal(t, 404, code)
 }
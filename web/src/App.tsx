@@ -63,6 +63,27 @@ const ModelList = ({}) => {
       });
   };
 
+  const togglePause = (model: string, paused: boolean) => {
+    const action = paused ? 'resume' : 'pause';
+    fetch(`${API_URL}/models/${model}/${action}`, {
+      method: 'POST',
+    })
+      .then((res) => res.json())
+      .then((data) => {
+        notification.success({
+          message: paused ? 'Resume' : 'Pause',
+          description: data.message,
+        });
+        reloadModels();
+      })
+      .catch((data) => {
+        notification.error({
+          message: paused ? 'Resume Failed' : 'Pause Failed',
+          description: data.message,
+        });
+      });
+  };
+
   const reloadModels = () => {
     setLoading(true);
     fetch(`${API_URL}/config`)
@@ -76,6 +97,7 @@ const ModelList = ({}) => {
   const ModelItem = ({ modelKey }: { modelKey: string }) => {
     const model = models[modelKey];
     const scheduleEnable = model.schedule?.enabled;
+    const paused = model.paused;
 
     return (
       <div className="model-list-item">
@@ -84,6 +106,13 @@ const ModelList = ({}) => {
           {scheduleEnable && (
             <div className="text-green text-sm">{model.schedule_info}</div>
           )}
+          {paused && (
+            <div className="text-yellow-500 text-xs">
+              Paused
+              {model.paused_until &&
+                ` until ${new Date(model.paused_until).toLocaleString()}`}
+            </div>
+          )}
           {model.description && (
             <div className="text-gray-400 truncate text-xs my-1">
               {model.description}
@@ -97,6 +126,16 @@ const ModelList = ({}) => {
             </Button>
           </Link>
 
+          {scheduleEnable && (
+            <Button
+              size="small"
+              title={paused ? 'Resume schedule' : 'Pause schedule'}
+              onClick={() => togglePause(modelKey, paused)}
+            >
+              <Icon name={paused ? 'play-circle' : 'pause-circle'} />
+            </Button>
+          )}
+
           <Popconfirm
             title="Perform Backup"
             description="Are you sure to perform backup now?"